@@ -0,0 +1,413 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"golang.org/x/sys/unix"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 15:20 2022/3/25
+ @Description: 使用 archive/tar 打包、解包，代替调用外部的 tar 命令
+*/
+
+// PAX 中保存 xattr 的前缀，与 GNU tar 保持一致
+const paxXattrPrefix = "SCHILY.xattr."
+
+// Progress 打包、解包的进度
+type Progress struct {
+	Files int   // 已处理的文件数
+	Bytes int64 // 已处理的文件内容字节数
+}
+
+// ProgressFunc 每处理完一个文件回调一次
+type ProgressFunc func(Progress)
+
+// 文件的唯一标识，同一文件的硬链接设备号与 inode 号都相同
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// TarOptions 打包、解包的选项
+type TarOptions struct {
+	Compression   Compression  // 打包时的压缩格式，解包时自动识别
+	OneFileSystem bool         // 打包时不进入其它挂载点，如挂载到容器中的数据卷
+	Progress      ProgressFunc // 进度回调
+}
+
+// Tar 将 src 打包成 tar 流写入 w，归档中的根名为 name
+// 不跟随符号链接，保留属主、权限、xattr、设备文件与硬链接
+func Tar(src, name string, w io.Writer, opts *TarOptions) error {
+	if opts == nil {
+		opts = &TarOptions{}
+	}
+	rootInfo, err := os.Lstat(src)
+	if err != nil {
+		return err
+	}
+	rootDev := rootInfo.Sys().(*syscall.Stat_t).Dev
+
+	cw, err := CompressStream(w, opts.Compression)
+	if err != nil {
+		return err
+	}
+	tw := tar.NewWriter(cw)
+	// 文件 -> 归档中第一次出现的名字，用于还原硬链接
+	// 不使用 OneFileSystem 时会跨越文件系统，inode 号只在同一设备上唯一
+	inodes := map[fileID]string{}
+	var progress Progress
+
+	err = filepath.Walk(src, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		// socket 无法打包
+		if info.Mode()&os.ModeSocket != 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(src, p)
+		if err != nil {
+			return err
+		}
+		stat := info.Sys().(*syscall.Stat_t)
+		// 挂载点本身保留，但不打包其中的内容
+		skipDir := opts.OneFileSystem && info.IsDir() && stat.Dev != rootDev
+
+		link := ""
+		if info.Mode()&os.ModeSymlink != 0 {
+			if link, err = os.Readlink(p); err != nil {
+				return err
+			}
+		}
+		header, err := tar.FileInfoHeader(info, link)
+		if err != nil {
+			return err
+		}
+		header.Name = path.Join(name, filepath.ToSlash(rel))
+		if info.IsDir() {
+			header.Name += "/"
+		}
+		if info.Mode().IsRegular() && stat.Nlink > 1 {
+			id := fileID{dev: uint64(stat.Dev), ino: stat.Ino}
+			if first, ok := inodes[id]; ok {
+				header.Typeflag = tar.TypeLink
+				header.Linkname = first
+				header.Size = 0
+			} else {
+				inodes[id] = header.Name
+			}
+		}
+		if err := readXattrs(p, header); err != nil {
+			return err
+		}
+
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg {
+			file, err := os.Open(p)
+			if err != nil {
+				return err
+			}
+			n, err := io.Copy(tw, file)
+			file.Close()
+			if err != nil {
+				return err
+			}
+			progress.Bytes += n
+		}
+		progress.Files++
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+
+		if skipDir {
+			return filepath.SkipDir
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return cw.Close()
+}
+
+// Untar 将 tar 流解包到 dest 目录下，自动识别 gzip 与 zstd 压缩
+// 归档中的路径都限制在 dest 内，不会通过 .. 或符号链接写到外面
+func Untar(r io.Reader, dest string, opts *TarOptions) error {
+	if opts == nil {
+		opts = &TarOptions{}
+	}
+	dr, err := DecompressStream(r)
+	if err != nil {
+		return err
+	}
+	defer dr.Close()
+
+	tr := tar.NewReader(dr)
+	// 目录的时间在其中的文件解压完后再恢复
+	var dirs []*tar.Header
+	var dirTargets []string
+	var progress Progress
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+
+		name := path.Clean("/" + header.Name)
+		target := dest
+		if name != "/" {
+			// 父目录中可能存在符号链接，按 dest 为根解析
+			dir, err := ResolvePath(dest, path.Dir(name))
+			if err != nil {
+				return err
+			}
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return err
+			}
+			target = filepath.Join(dir, path.Base(name))
+		}
+
+		if err := untarEntry(tr, header, dest, target); err != nil {
+			return fmt.Errorf("extract %s error %v", header.Name, err)
+		}
+		if header.Typeflag == tar.TypeDir {
+			dirs = append(dirs, header)
+			dirTargets = append(dirTargets, target)
+		}
+
+		progress.Files++
+		progress.Bytes += header.Size
+		if opts.Progress != nil {
+			opts.Progress(progress)
+		}
+	}
+
+	for i, header := range dirs {
+		if err := setTimes(dirTargets[i], header); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// UntarAtomic 先解包到同级的临时目录，成功后再重命名为 dest
+// 解包失败时不会留下不完整的 dest；dest 已存在时返回的错误满足 os.IsExist
+// 并发解包到同一个 dest 时，先完成的重命名成功，其余的丢弃自己的临时目录并视为成功
+func UntarAtomic(r io.Reader, dest string, opts *TarOptions) error {
+	dest = filepath.Clean(dest)
+	if _, err := os.Lstat(dest); err == nil {
+		return &os.PathError{Op: "untar", Path: dest, Err: os.ErrExist}
+	}
+	tmpDir, err := ioutil.TempDir(filepath.Dir(dest), TempPrefix(dest))
+	if err != nil {
+		return err
+	}
+	// TempDir 创建的目录权限为 0700，归档中没有根目录时使用默认权限
+	if err := os.Chmod(tmpDir, 0755); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := Untar(r, tmpDir, opts); err != nil {
+		os.RemoveAll(tmpDir)
+		return err
+	}
+	if err := os.Rename(tmpDir, dest); err != nil {
+		os.RemoveAll(tmpDir)
+		if _, statErr := os.Lstat(dest); statErr == nil {
+			return nil
+		}
+		return err
+	}
+	return nil
+}
+
+// TempPrefix UntarAtomic 使用的临时目录前缀，崩溃后残留的临时目录可以据此清理
+func TempPrefix(dest string) string {
+	return "." + filepath.Base(dest) + ".tmp-"
+}
+
+// 根据 tar 头的类型创建对应的文件，并恢复属主、权限、xattr 与时间
+func untarEntry(tr *tar.Reader, header *tar.Header, dest, target string) error {
+	mode := os.FileMode(header.Mode).Perm()
+	// 目录以外的类型，已存在时先删除
+	if header.Typeflag != tar.TypeDir {
+		if fi, err := os.Lstat(target); err == nil && !fi.IsDir() {
+			if err := os.Remove(target); err != nil {
+				return err
+			}
+		}
+	}
+
+	switch header.Typeflag {
+	case tar.TypeDir:
+		if fi, err := os.Lstat(target); err != nil || !fi.IsDir() {
+			if err := os.Mkdir(target, mode); err != nil {
+				return err
+			}
+		}
+	case tar.TypeReg, tar.TypeRegA:
+		file, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, mode)
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(file, tr)
+		file.Close()
+		if err != nil {
+			return err
+		}
+	case tar.TypeSymlink:
+		if err := os.Symlink(header.Linkname, target); err != nil {
+			return err
+		}
+	case tar.TypeLink:
+		// 与解包的目标相同，只解析父目录，链接目标本身是符号链接时链接到符号链接，而不是它指向的文件
+		linkName := path.Clean("/" + header.Linkname)
+		if linkName == "/" {
+			return fmt.Errorf("invalid hard link target %s", header.Linkname)
+		}
+		dir, err := ResolvePath(dest, path.Dir(linkName))
+		if err != nil {
+			return err
+		}
+		// 硬链接与目标共享 inode，不需要再恢复属性
+		return os.Link(filepath.Join(dir, path.Base(linkName)), target)
+	case tar.TypeChar, tar.TypeBlock, tar.TypeFifo:
+		devMode := uint32(syscall.S_IFCHR)
+		if header.Typeflag == tar.TypeBlock {
+			devMode = syscall.S_IFBLK
+		} else if header.Typeflag == tar.TypeFifo {
+			devMode = syscall.S_IFIFO
+		}
+		dev := unix.Mkdev(uint32(header.Devmajor), uint32(header.Devminor))
+		if err := syscall.Mknod(target, devMode|uint32(mode), int(dev)); err != nil {
+			return err
+		}
+	default:
+		return nil
+	}
+
+	if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+		return err
+	}
+	if err := writeXattrs(target, header); err != nil {
+		return err
+	}
+	if header.Typeflag == tar.TypeSymlink {
+		return setTimes(target, header)
+	}
+	// chown 会清除 setuid 位，需在之后 chmod
+	if err := os.Chmod(target, mode|specialMode(header.Mode)); err != nil {
+		return err
+	}
+	if header.Typeflag == tar.TypeDir {
+		return nil
+	}
+	return setTimes(target, header)
+}
+
+// 读取文件的 xattr 存入 PAX 记录
+func readXattrs(p string, header *tar.Header) error {
+	size, err := unix.Llistxattr(p, nil)
+	if err != nil || size == 0 {
+		// 文件系统不支持 xattr 时忽略
+		if err == unix.ENOTSUP || err == unix.EOPNOTSUPP {
+			return nil
+		}
+		return err
+	}
+	buf := make([]byte, size)
+	if size, err = unix.Llistxattr(p, buf); err != nil {
+		return err
+	}
+	for _, key := range bytes.Split(buf[:size], []byte{0}) {
+		if len(key) == 0 {
+			continue
+		}
+		value, err := lgetxattr(p, string(key))
+		if err != nil {
+			return err
+		}
+		if header.PAXRecords == nil {
+			header.PAXRecords = map[string]string{}
+		}
+		header.PAXRecords[paxXattrPrefix+string(key)] = string(value)
+		header.Format = tar.FormatPAX
+	}
+	return nil
+}
+
+func lgetxattr(p, key string) ([]byte, error) {
+	size, err := unix.Lgetxattr(p, key, nil)
+	if err != nil {
+		return nil, err
+	}
+	value := make([]byte, size)
+	if size, err = unix.Lgetxattr(p, key, value); err != nil {
+		return nil, err
+	}
+	return value[:size], nil
+}
+
+// 将 PAX 记录中的 xattr 写回文件
+func writeXattrs(target string, header *tar.Header) error {
+	for key, value := range header.PAXRecords {
+		if !strings.HasPrefix(key, paxXattrPrefix) {
+			continue
+		}
+		key = strings.TrimPrefix(key, paxXattrPrefix)
+		if err := unix.Lsetxattr(target, key, []byte(value), 0); err != nil {
+			// 目标文件系统不支持该 xattr 时忽略，如 tmpfs 上的 user.*
+			if err == unix.ENOTSUP || err == unix.EOPNOTSUPP {
+				continue
+			}
+			return fmt.Errorf("set xattr %s error %v", key, err)
+		}
+	}
+	return nil
+}
+
+// 恢复访问时间与修改时间，不跟随符号链接
+func setTimes(target string, header *tar.Header) error {
+	accessTime := header.AccessTime
+	if accessTime.IsZero() {
+		accessTime = header.ModTime
+	}
+	ts := []unix.Timespec{
+		unix.NsecToTimespec(accessTime.UnixNano()),
+		unix.NsecToTimespec(header.ModTime.UnixNano()),
+	}
+	return unix.UtimesNanoAt(unix.AT_FDCWD, target, ts, unix.AT_SYMLINK_NOFOLLOW)
+}
+
+// 恢复 setuid、setgid、sticky 位
+func specialMode(mode int64) os.FileMode {
+	var m os.FileMode
+	if mode&04000 != 0 {
+		m |= os.ModeSetuid
+	}
+	if mode&02000 != 0 {
+		m |= os.ModeSetgid
+	}
+	if mode&01000 != 0 {
+		m |= os.ModeSticky
+	}
+	return m
+}
@@ -0,0 +1,228 @@
+package archive
+
+import (
+	"archive/tar"
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"testing"
+)
+
+// 按顺序写入 tar 头，普通文件的内容为 content
+func buildTar(t *testing.T, headers []*tar.Header, content string) []byte {
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	for _, h := range headers {
+		if h.Typeflag == tar.TypeReg {
+			h.Size = int64(len(content))
+		}
+		if h.Mode == 0 {
+			h.Mode = 0644
+		}
+		if err := tw.WriteHeader(h); err != nil {
+			t.Fatal(err)
+		}
+		if h.Typeflag == tar.TypeReg {
+			if _, err := tw.Write([]byte(content)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func tempDir(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "copyDocker-archive")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	return dir
+}
+
+func TestUntarEscape(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+		inside  string // 解包后 dest 中应存在的文件
+		wantErr bool
+	}{
+		{
+			name:    "dot dot in name",
+			headers: []*tar.Header{{Name: "../../evil", Typeflag: tar.TypeReg}},
+			inside:  "evil",
+		},
+		{
+			name: "absolute symlink parent",
+			headers: []*tar.Header{
+				{Name: "abs", Typeflag: tar.TypeSymlink, Linkname: "/"},
+				{Name: "abs/evil", Typeflag: tar.TypeReg},
+			},
+			inside: "evil",
+		},
+		{
+			name: "relative symlink parent",
+			headers: []*tar.Header{
+				{Name: "up", Typeflag: tar.TypeSymlink, Linkname: "../.."},
+				{Name: "up/evil", Typeflag: tar.TypeReg},
+			},
+			wantErr: true,
+		},
+		{
+			name:    "hard link outside",
+			headers: []*tar.Header{{Name: "evil", Typeflag: tar.TypeLink, Linkname: "../../outside/secret"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// dest 位于 base/a/dest，逃逸的文件会出现在 base 中
+			base := tempDir(t)
+			dest := filepath.Join(base, "a", "dest")
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				t.Fatal(err)
+			}
+			err := Untar(bytes.NewReader(buildTar(t, tt.headers, "data")), dest, nil)
+			if tt.wantErr != (err != nil) {
+				t.Fatalf("untar error %v, want error %v", err, tt.wantErr)
+			}
+			if tt.inside != "" {
+				if _, err := os.Stat(filepath.Join(dest, tt.inside)); err != nil {
+					t.Errorf("%s not extracted inside dest: %v", tt.inside, err)
+				}
+			}
+			for _, p := range []string{filepath.Join(base, "evil"), filepath.Join(base, "a", "evil"), "/evil"} {
+				if _, err := os.Lstat(p); err == nil {
+					t.Errorf("%s written outside dest", p)
+				}
+			}
+		})
+	}
+}
+
+func TestTarHardLinks(t *testing.T) {
+	src := tempDir(t)
+	if err := ioutil.WriteFile(filepath.Join(src, "a"), []byte("data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Link(filepath.Join(src, "a"), filepath.Join(src, "b")); err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Tar(src, ".", &buf, &TarOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	dest := tempDir(t)
+	if err := Untar(&buf, dest, nil); err != nil {
+		t.Fatal(err)
+	}
+	var a, b syscall.Stat_t
+	if err := syscall.Stat(filepath.Join(dest, "a"), &a); err != nil {
+		t.Fatal(err)
+	}
+	if err := syscall.Stat(filepath.Join(dest, "b"), &b); err != nil {
+		t.Fatal(err)
+	}
+	if a.Ino != b.Ino {
+		t.Errorf("hard link not restored: inode %d != %d", a.Ino, b.Ino)
+	}
+}
+
+func TestUntarHardLinkTarget(t *testing.T) {
+	tests := []struct {
+		name    string
+		headers []*tar.Header
+		same    string // 与 hl 共享 inode 的文件
+		symlink string // hl 为符号链接时的链接目标
+	}{
+		{
+			name: "link to symlink",
+			headers: []*tar.Header{
+				{Name: "target", Typeflag: tar.TypeReg},
+				{Name: "sym", Typeflag: tar.TypeSymlink, Linkname: "target"},
+				{Name: "hl", Typeflag: tar.TypeLink, Linkname: "sym"},
+			},
+			same:    "sym",
+			symlink: "target",
+		},
+		{
+			name: "link to absolute symlink",
+			headers: []*tar.Header{
+				{Name: "abs", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"},
+				{Name: "hl", Typeflag: tar.TypeLink, Linkname: "abs"},
+			},
+			same:    "abs",
+			symlink: "/etc/passwd",
+		},
+		{
+			name: "symlink in parent",
+			headers: []*tar.Header{
+				{Name: "real/", Typeflag: tar.TypeDir, Mode: 0755},
+				{Name: "real/f", Typeflag: tar.TypeReg},
+				{Name: "d", Typeflag: tar.TypeSymlink, Linkname: "/real"},
+				{Name: "hl", Typeflag: tar.TypeLink, Linkname: "d/f"},
+			},
+			same: "real/f",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dest := tempDir(t)
+			if err := Untar(bytes.NewReader(buildTar(t, tt.headers, "data")), dest, nil); err != nil {
+				t.Fatal(err)
+			}
+			var hl, same syscall.Stat_t
+			if err := syscall.Lstat(filepath.Join(dest, "hl"), &hl); err != nil {
+				t.Fatal(err)
+			}
+			if err := syscall.Lstat(filepath.Join(dest, tt.same), &same); err != nil {
+				t.Fatal(err)
+			}
+			if hl.Ino != same.Ino {
+				t.Errorf("hl not linked to %s: inode %d != %d", tt.same, hl.Ino, same.Ino)
+			}
+			link, _ := os.Readlink(filepath.Join(dest, "hl"))
+			if link != tt.symlink {
+				t.Errorf("hl links to %q, want %q", link, tt.symlink)
+			}
+		})
+	}
+}
+
+func TestUntarAtomicConcurrent(t *testing.T) {
+	data := buildTar(t, []*tar.Header{{Name: "file", Typeflag: tar.TypeReg}}, "data")
+	dest := filepath.Join(tempDir(t), "layer")
+
+	var wg sync.WaitGroup
+	errs := make([]error, 4)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			errs[i] = UntarAtomic(bytes.NewReader(data), dest, nil)
+		}(i)
+	}
+	wg.Wait()
+	// 先完成的成功，其余的或者视为成功，或者在开始前就发现 dest 已存在
+	for i, err := range errs {
+		if err != nil && !os.IsExist(err) {
+			t.Errorf("untar %d error %v", i, err)
+		}
+	}
+	if content, err := ioutil.ReadFile(filepath.Join(dest, "file")); err != nil || string(content) != "data" {
+		t.Errorf("read extracted file = %q, %v", content, err)
+	}
+	files, _ := ioutil.ReadDir(filepath.Dir(dest))
+	if len(files) != 1 {
+		t.Errorf("temp dirs left: %d entries", len(files))
+	}
+	if err := UntarAtomic(bytes.NewReader(data), dest, nil); !os.IsExist(err) {
+		t.Errorf("untar into existing dest error = %v, want exist", err)
+	}
+}
@@ -0,0 +1,96 @@
+package archive
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"github.com/klauspost/compress/zstd"
+	"io"
+	"io/ioutil"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 16:10 2022/3/25
+ @Description: tar 包的压缩与解压，支持 gzip 与 zstd
+*/
+
+// Compression 压缩格式
+type Compression int
+
+const (
+	Uncompressed Compression = iota
+	Gzip
+	Zstd
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+func (c Compression) String() string {
+	switch c {
+	case Gzip:
+		return "gzip"
+	case Zstd:
+		return "zstd"
+	default:
+		return "none"
+	}
+}
+
+// DetectCompression 根据文件头的魔数判断压缩格式
+func DetectCompression(header []byte) Compression {
+	switch {
+	case bytes.HasPrefix(header, gzipMagic):
+		return Gzip
+	case bytes.HasPrefix(header, zstdMagic):
+		return Zstd
+	default:
+		return Uncompressed
+	}
+}
+
+// DecompressStream 自动识别压缩格式，返回解压后的数据流
+func DecompressStream(r io.Reader) (io.ReadCloser, error) {
+	buf := bufio.NewReader(r)
+	// 数据不足 4 字节时 Peek 返回错误，按未压缩处理
+	header, _ := buf.Peek(len(zstdMagic))
+
+	switch DetectCompression(header) {
+	case Gzip:
+		return gzip.NewReader(buf)
+	case Zstd:
+		decoder, err := zstd.NewReader(buf)
+		if err != nil {
+			return nil, err
+		}
+		return decoder.IOReadCloser(), nil
+	default:
+		return ioutil.NopCloser(buf), nil
+	}
+}
+
+// CompressStream 按照指定的压缩格式包装 w，关闭时写入剩余的数据
+func CompressStream(w io.Writer, c Compression) (io.WriteCloser, error) {
+	switch c {
+	case Gzip:
+		return gzip.NewWriter(w), nil
+	case Zstd:
+		return zstd.NewWriter(w)
+	case Uncompressed:
+		return nopWriteCloser{w}, nil
+	default:
+		return nil, fmt.Errorf("unsupported compression %d", c)
+	}
+}
+
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
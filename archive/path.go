@@ -0,0 +1,77 @@
+package archive
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 10:12 2022/3/23
+ @Description: 在根目录内安全地解析路径，用于容器内路径与 tar 包的解压
+*/
+
+// 解析时最多跟随的符号链接数，与内核的 MAXSYMLINKS 保持一致
+const maxSymlinks = 40
+
+// ResolvePath 将 root 内的路径（如容器内的路径）解析为宿主机上的路径
+// 路径中的符号链接按照 root 的视角解析，即绝对链接相对于 root，
+// 一旦解析结果跳出 root（如 ../../etc/shadow），直接报错
+// 路径末尾不存在的部分原样保留，便于作为拷贝的目标
+func ResolvePath(root, unsafePath string) (string, error) {
+	resolved := ""
+	remaining := unsafePath
+	links := 0
+	for remaining != "" {
+		var part string
+		if i := strings.IndexByte(remaining, '/'); i == -1 {
+			part, remaining = remaining, ""
+		} else {
+			part, remaining = remaining[:i], remaining[i+1:]
+		}
+		if part == "" || part == "." {
+			continue
+		}
+		if part == ".." {
+			if resolved == "" {
+				return "", fmt.Errorf("path %s escapes root %s", unsafePath, root)
+			}
+			resolved = filepath.Dir(resolved)
+			if resolved == "." {
+				resolved = ""
+			}
+			continue
+		}
+
+		next := filepath.Join(resolved, part)
+		fi, err := os.Lstat(filepath.Join(root, next))
+		if err != nil {
+			if os.IsNotExist(err) {
+				resolved = next
+				continue
+			}
+			return "", err
+		}
+		if fi.Mode()&os.ModeSymlink == 0 {
+			resolved = next
+			continue
+		}
+
+		// 符号链接，将链接目标拼接到剩余路径前继续解析
+		links++
+		if links > maxSymlinks {
+			return "", fmt.Errorf("too many symlinks in %s", unsafePath)
+		}
+		dest, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(dest) {
+			resolved = ""
+		}
+		remaining = dest + "/" + remaining
+	}
+	return filepath.Join(root, resolved), nil
+}
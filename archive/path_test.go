@@ -0,0 +1,71 @@
+package archive
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 在临时目录中创建 root，其中 etc 为目录，其余为符号链接
+func setupResolveRoot(t *testing.T) string {
+	root, err := ioutil.TempDir("", "copyDocker-resolve")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(root) })
+	if err := os.MkdirAll(filepath.Join(root, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	links := map[string]string{
+		"abs":    "/etc",
+		"rel":    "etc",
+		"up":     "../../..",
+		"loop":   "loop",
+		"nested": "abs/../up",
+	}
+	for name, dest := range links {
+		if err := os.Symlink(dest, filepath.Join(root, name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestResolvePath(t *testing.T) {
+	root := setupResolveRoot(t)
+	tests := []struct {
+		path    string
+		want    string
+		wantErr bool
+	}{
+		{path: "/", want: ""},
+		{path: "/etc/passwd", want: "etc/passwd"},
+		{path: "etc/../etc/./passwd", want: "etc/passwd"},
+		{path: "/abs/passwd", want: "etc/passwd"},
+		{path: "/rel/passwd", want: "etc/passwd"},
+		{path: "/missing/dir/file", want: "missing/dir/file"},
+		{path: "/..", wantErr: true},
+		{path: "/etc/../../shadow", wantErr: true},
+		{path: "/up/etc/shadow", wantErr: true},
+		{path: "/nested/etc", wantErr: true},
+		{path: "/loop/x", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			got, err := ResolvePath(root, tt.path)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ResolvePath(%s) = %s, want error", tt.path, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ResolvePath(%s) error %v", tt.path, err)
+			}
+			if want := filepath.Join(root, tt.want); got != want {
+				t.Errorf("ResolvePath(%s) = %s, want %s", tt.path, got, want)
+			}
+		})
+	}
+}
@@ -2,7 +2,12 @@ package cgroups
 
 import (
 	"copyDocker/cgroups/subsystems"
+	"fmt"
 	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
 )
 
 /*
@@ -22,28 +27,135 @@ func NewCgroupManager(path string) *CgroupManager {
 	return &CgroupManager{Path: path}
 }
 
-// Apply 将进程 PID 加入到每个 cgroup
+// Parent 容器的 cgroup 都创建在各 subsystem 根节点下的 copyDocker 中，prune 只清理其中的 cgroup
+const Parent = "copyDocker"
+
+// ContainerPath 容器的 cgroup 路径 copyDocker/${id}
+// 之前版本在根节点下以容器 ID 创建 cgroup，运行中的旧容器仍然使用原来的路径
+func ContainerPath(id string) string {
+	for _, subSysIns := range subsystems.SubsystemsIns {
+		root := subsystems.Root(subSysIns)
+		if root == "" {
+			continue
+		}
+		if _, err := os.Stat(path.Join(root, id)); err == nil {
+			return id
+		}
+	}
+	return path.Join(Parent, id)
+}
+
+// Apply 将进程 PID 加入到每个 cgroup，任一 subsystem 失败即返回
 func (c *CgroupManager) Apply(pid int) error {
 	for _, subSysIns := range subsystems.SubsystemsIns {
-		subSysIns.Apply(c.Path, pid)
+		if err := subSysIns.Apply(c.Path, pid); err != nil {
+			return fmt.Errorf("apply %s cgroup error: %v", subSysIns.Name(), err)
+		}
 	}
 	return nil
 }
 
-// Set 设置对应 subsystem 挂载中 cgroup 资源限制
+// Set 创建各 subsystem 中的 cgroup 并设置资源限制，任一 subsystem 失败即返回
 func (c *CgroupManager) Set(config *subsystems.ResourceConfig) error {
+	c.Resource = config
 	for _, subSysIns := range subsystems.SubsystemsIns {
-		subSysIns.Set(c.Path, config)
+		if err := subSysIns.Set(c.Path, config); err != nil {
+			return fmt.Errorf("set %s cgroup error: %v", subSysIns.Name(), err)
+		}
 	}
 	return nil
 }
 
-// Destroy 释放各 subsystem 挂载中的cgroup
+// Destroy 释放各 subsystem 挂载中的cgroup，跳过不存在的 cgroup，返回删除失败的 subsystem
 func (c *CgroupManager) Destroy() error {
+	var failed []string
 	for _, subSysIns := range subsystems.SubsystemsIns {
+		root := subsystems.Root(subSysIns)
+		if root == "" {
+			continue
+		}
+		if _, err := os.Stat(path.Join(root, c.Path)); os.IsNotExist(err) {
+			continue
+		}
 		if err := subSysIns.Remove(c.Path); err != nil {
-			logrus.Warnf("remove cgroup fail %v,path: %s", err,c.Path)
+			logrus.Warnf("remove cgroup fail %v,path: %s", err, c.Path)
+			failed = append(failed, subSysIns.Name())
 		}
 	}
+	if len(failed) > 0 {
+		return fmt.Errorf("remove cgroup %s in %s error", c.Path, strings.Join(failed, ","))
+	}
 	return nil
 }
+
+// Paths 返回各 subsystem 中仍然存在的 cgroup 目录
+func (c *CgroupManager) Paths() []string {
+	var paths []string
+	for _, subSysIns := range subsystems.SubsystemsIns {
+		root := subsystems.Root(subSysIns)
+		if root == "" {
+			continue
+		}
+		cgroupPath := path.Join(root, c.Path)
+		if _, err := os.Stat(cgroupPath); err == nil {
+			paths = append(paths, cgroupPath)
+		}
+	}
+	return paths
+}
+
+// ListCgroups 列出各 subsystem 中 copyDocker 下名字满足 match 的 cgroup，返回相对于根节点的路径
+func ListCgroups(match func(name string) bool) []string {
+	seen := map[string]bool{}
+	var paths []string
+	for _, subSysIns := range subsystems.SubsystemsIns {
+		root := subsystems.Root(subSysIns)
+		if root == "" {
+			continue
+		}
+		files, err := ioutil.ReadDir(path.Join(root, Parent))
+		if err != nil {
+			if !os.IsNotExist(err) {
+				logrus.Warnf("read cgroup %s fail %v", path.Join(root, Parent), err)
+			}
+			continue
+		}
+		for _, f := range files {
+			if !f.IsDir() || seen[f.Name()] || !match(f.Name()) {
+				continue
+			}
+			seen[f.Name()] = true
+			paths = append(paths, path.Join(Parent, f.Name()))
+		}
+	}
+	return paths
+}
+
+// OOMKilled 判断容器中是否有进程因内存超限被杀死，需在 Destroy 之前调用
+func (c *CgroupManager) OOMKilled() bool {
+	for _, subSysIns := range subsystems.SubsystemsIns {
+		if memory, ok := subSysIns.(*subsystems.MemorySubsystem); ok {
+			return memory.OOMKilled(c.Path)
+		}
+	}
+	return false
+}
+
+// Freeze 暂停容器中的所有进程
+func (c *CgroupManager) Freeze() error {
+	return c.freezer(func(f *subsystems.FreezerSubsystem) error { return f.Freeze(c.Path) })
+}
+
+// Thaw 恢复被暂停的进程
+func (c *CgroupManager) Thaw() error {
+	return c.freezer(func(f *subsystems.FreezerSubsystem) error { return f.Thaw(c.Path) })
+}
+
+func (c *CgroupManager) freezer(fn func(f *subsystems.FreezerSubsystem) error) error {
+	for _, subSysIns := range subsystems.SubsystemsIns {
+		if freezer, ok := subSysIns.(*subsystems.FreezerSubsystem); ok {
+			return fn(freezer)
+		}
+	}
+	return fmt.Errorf("freezer subsystem is not enabled")
+}
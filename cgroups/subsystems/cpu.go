@@ -5,7 +5,6 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
-	"strconv"
 )
 
 /*
@@ -16,13 +15,20 @@ import (
 
 type CpuSubsystem struct{}
 
+// Set 设置 CPU 时间片的权重，没有挂载 cpu subsystem 时只有设置了权重才报错
 func (s *CpuSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if FindCgroupMountpoint(s.Name()) == "" {
+		if res.CpuShare != "" {
+			return fmt.Errorf("cpu cgroup is not mounted")
+		}
+		return nil
+	}
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err != nil {
 		return err
 	} else {
 		if res.CpuShare != "" {
 			// 将对应的限制信息写入文件
-			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cpu.share"), []byte(res.CpuShare), 0644); err != nil {
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cpu.shares"), []byte(res.CpuShare), 0644); err != nil {
 				return fmt.Errorf("set cgroup cpu share fail %v", err)
 			}
 		}
@@ -32,18 +38,21 @@ func (s *CpuSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
 
 // Apply 将该进程加入 subsystem
 func (s *CpuSubsystem) Apply(cgroupPath string, pid int) error {
+	if FindCgroupMountpoint(s.Name()) == "" {
+		return nil
+	}
 	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false)
 	if err != nil {
 		return err
 	}
-	if err:=ioutil.WriteFile(path.Join(subsysCgroupPath,"tasks"),[]byte(strconv.Itoa(pid)),0644);err!=nil{
-		return fmt.Errorf("set cgroup proc fail %v",err)
-	}
-	return nil
+	return writeCgroupProcs(subsysCgroupPath, pid)
 }
 
 // Remove 移除对应的文件
 func (s *CpuSubsystem) Remove(cgroupPath string) error {
+	if FindCgroupMountpoint(s.Name()) == "" {
+		return nil
+	}
 	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false)
 	if err != nil {
 		return err
@@ -5,7 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
-	"strconv"
+	"strings"
 )
 
 /*
@@ -17,32 +17,88 @@ import (
 type CpusetSubSystem struct{}
 
 // Set 初始化 hierarchy，对 cpu 核心数的限制
+// 新建的 cpuset cgroup 中 cpus 与 mems 都为空，此时无法加入进程，未指定时继承父节点的值
+// 没有挂载 cpuset subsystem 时只有设置了 cpus 才报错
 func (s *CpusetSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if FindCgroupMountpoint(s.Name()) == "" {
+		if res.CpuSet != "" {
+			return fmt.Errorf("cpuset cgroup is not mounted")
+		}
+		return nil
+	}
 	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true)
 	if err != nil {
 		return err
 	}
-	if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cpuset.cpus"), []byte(res.CpuSet), 0644); err != nil {
+	parentPath := path.Dir(subsysCgroupPath)
+	if err := inheritCpuset(parentPath, FindCgroupMountpoint(s.Name())); err != nil {
+		return err
+	}
+	cpus := res.CpuSet
+	if cpus == "" {
+		content, err := ioutil.ReadFile(path.Join(parentPath, "cpuset.cpus"))
+		if err != nil {
+			return fmt.Errorf("read parent cpuset fail %v", err)
+		}
+		cpus = strings.TrimSpace(string(content))
+	}
+	if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cpuset.cpus"), []byte(cpus), 0644); err != nil {
 		return fmt.Errorf("set cgroup cpuset fail %v", err)
 	}
+
+	mems, err := ioutil.ReadFile(path.Join(parentPath, "cpuset.mems"))
+	if err != nil {
+		return fmt.Errorf("read parent cpuset mems fail %v", err)
+	}
+	if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cpuset.mems"), []byte(strings.TrimSpace(string(mems))), 0644); err != nil {
+		return fmt.Errorf("set cgroup cpuset mems fail %v", err)
+	}
 	return nil
+}
 
+// 父节点（如 copyDocker）同样可能是新建的，cpus 或 mems 为空时逐级从上一级继承
+func inheritCpuset(dir, root string) error {
+	if dir == root || !strings.HasPrefix(dir, root) {
+		return nil
+	}
+	for _, file := range []string{"cpuset.cpus", "cpuset.mems"} {
+		content, err := ioutil.ReadFile(path.Join(dir, file))
+		if err != nil {
+			return fmt.Errorf("read cpuset %s fail %v", dir, err)
+		}
+		if strings.TrimSpace(string(content)) != "" {
+			continue
+		}
+		if err := inheritCpuset(path.Dir(dir), root); err != nil {
+			return err
+		}
+		content, err = ioutil.ReadFile(path.Join(path.Dir(dir), file))
+		if err != nil {
+			return fmt.Errorf("read parent cpuset fail %v", err)
+		}
+		if err := ioutil.WriteFile(path.Join(dir, file), []byte(strings.TrimSpace(string(content))), 0644); err != nil {
+			return fmt.Errorf("set cgroup cpuset fail %v", err)
+		}
+	}
+	return nil
 }
 
 func (s *CpusetSubSystem) Apply(cgroupPath string, pid int) error {
+	if FindCgroupMountpoint(s.Name()) == "" {
+		return nil
+	}
 	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false)
 	if err != nil {
 		return err
 	}
-	err = ioutil.WriteFile(path.Join(subsysCgroupPath, "tasks"), []byte(strconv.Itoa(pid)), 0644)
-	if err != nil {
-		return fmt.Errorf("set cgroup proc fail %v", err)
-	}
-	return nil
+	return writeCgroupProcs(subsysCgroupPath, pid)
 }
 
 // Remove 移除对应的文件
 func (s *CpusetSubSystem) Remove(cgroupPath string) error {
+	if FindCgroupMountpoint(s.Name()) == "" {
+		return nil
+	}
 	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false)
 	if err != nil {
 		return err
@@ -0,0 +1,187 @@
+package subsystems
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 14:20 2022/3/29
+ @Description: freezer，暂停与恢复 cgroup 中的所有进程
+*/
+
+// 等待 cgroup 冻结完成的最长时间
+const freezeTimeout = 5 * time.Second
+
+type FreezerSubsystem struct{}
+
+// Set freezer 没有资源限制，只创建 cgroup
+// freezer 只用于 pause，既没有 v1 的 freezer 也没有 cgroup v2 时不影响容器运行
+func (s *FreezerSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if s.root() == "" {
+		return nil
+	}
+	_, _, err := s.cgroupPath(cgroupPath, true)
+	return err
+}
+
+// Apply 使进程加入某个 cgroup
+func (s *FreezerSubsystem) Apply(cgroupPath string, pid int) error {
+	if s.root() == "" {
+		return nil
+	}
+	subsysCgroupPath, _, err := s.cgroupPath(cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return writeCgroupProcs(subsysCgroupPath, pid)
+}
+
+// Remove 删除对应的 cgroup
+func (s *FreezerSubsystem) Remove(cgroupPath string) error {
+	if s.root() == "" {
+		return nil
+	}
+	subsysCgroupPath, _, err := s.cgroupPath(cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.Remove(subsysCgroupPath)
+}
+
+// Name 返回对应名称
+func (s *FreezerSubsystem) Name() string {
+	return "freezer"
+}
+
+// Freeze 冻结 cgroup 中的所有进程，等待冻结完成后返回
+func (s *FreezerSubsystem) Freeze(cgroupPath string) error {
+	return s.setState(cgroupPath, true)
+}
+
+// Thaw 恢复 cgroup 中的所有进程
+func (s *FreezerSubsystem) Thaw(cgroupPath string) error {
+	return s.setState(cgroupPath, false)
+}
+
+// Frozen 判断 cgroup 是否已经冻结
+func (s *FreezerSubsystem) Frozen(cgroupPath string) (bool, error) {
+	subsysCgroupPath, v2, err := s.cgroupPath(cgroupPath, false)
+	if err != nil {
+		return false, err
+	}
+	if v2 {
+		// cgroup.events 中 frozen 1 表示冻结完成
+		content, err := ioutil.ReadFile(path.Join(subsysCgroupPath, "cgroup.events"))
+		if err != nil {
+			return false, err
+		}
+		for _, line := range strings.Split(string(content), "\n") {
+			if fields := strings.Fields(line); len(fields) == 2 && fields[0] == "frozen" {
+				return fields[1] == "1", nil
+			}
+		}
+		return false, nil
+	}
+	// v1 的 freezer.state 为 THAWED、FREEZING 或 FROZEN
+	content, err := ioutil.ReadFile(path.Join(subsysCgroupPath, "freezer.state"))
+	if err != nil {
+		return false, err
+	}
+	return strings.TrimSpace(string(content)) == "FROZEN", nil
+}
+
+// 写入冻结或恢复的状态，冻结时等待所有进程真正停下来
+func (s *FreezerSubsystem) setState(cgroupPath string, freeze bool) error {
+	subsysCgroupPath, v2, err := s.cgroupPath(cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	file, frozenState, thawedState := "freezer.state", "FROZEN", "THAWED"
+	if v2 {
+		file, frozenState, thawedState = "cgroup.freeze", "1", "0"
+	}
+	state := thawedState
+	if freeze {
+		state = frozenState
+	}
+	if err := ioutil.WriteFile(path.Join(subsysCgroupPath, file), []byte(state), 0644); err != nil {
+		return fmt.Errorf("set cgroup freezer state fail %v", err)
+	}
+	if !freeze {
+		return nil
+	}
+	deadline := time.Now().Add(freezeTimeout)
+	for {
+		frozen, err := s.Frozen(cgroupPath)
+		if err != nil {
+			return err
+		}
+		if frozen {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			// 冻结失败时恢复，避免进程停在 FREEZING 状态
+			ioutil.WriteFile(path.Join(subsysCgroupPath, file), []byte(thawedState), 0644)
+			return fmt.Errorf("timeout waiting for cgroup %s to freeze", cgroupPath)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// freezer cgroup 的根节点，优先使用 v1 的 freezer，没有时使用 cgroup v2
+func (s *FreezerSubsystem) root() string {
+	if root := FindCgroupMountpoint(s.Name()); root != "" {
+		return root
+	}
+	return findCgroup2Mountpoint()
+}
+
+// 获取 freezer cgroup 的路径，没有挂载 v1 的 freezer 时使用 cgroup v2，第二个返回值表示是否为 v2
+func (s *FreezerSubsystem) cgroupPath(cgroupPath string, autoCreate bool) (string, bool, error) {
+	if FindCgroupMountpoint(s.Name()) != "" {
+		subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, autoCreate)
+		return subsysCgroupPath, false, err
+	}
+	root := findCgroup2Mountpoint()
+	if root == "" {
+		return "", false, fmt.Errorf("neither freezer cgroup nor cgroup v2 is mounted")
+	}
+	subsysCgroupPath := path.Join(root, cgroupPath)
+	if _, err := os.Stat(subsysCgroupPath); err != nil {
+		if !autoCreate || !os.IsNotExist(err) {
+			return "", true, fmt.Errorf("cgroup path error:%v", err)
+		}
+		if err := os.MkdirAll(subsysCgroupPath, 0755); err != nil {
+			return "", true, fmt.Errorf("error create cgroup:%v", err)
+		}
+	}
+	return subsysCgroupPath, true, nil
+}
+
+// 找到 cgroup v2 的挂载点
+func findCgroup2Mountpoint() string {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return ""
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 30 23 0:26 / /sys/fs/cgroup rw,nosuid,nodev,noexec,relatime shared:4 - cgroup2 cgroup2 rw
+		fields := strings.Split(scanner.Text(), " ")
+		for i, field := range fields {
+			if field == "-" && i+1 < len(fields) && fields[i+1] == "cgroup2" {
+				return fields[4]
+			}
+		}
+	}
+	return ""
+}
@@ -5,7 +5,7 @@ import (
 	"io/ioutil"
 	"os"
 	"path"
-	"strconv"
+	"strings"
 )
 
 /*
@@ -17,9 +17,16 @@ import (
 type MemorySubsystem struct{}
 
 // Set 设置 cgroup 的内存资源限制
+// 没有挂载 memory subsystem 的机器上，只有设置了限制时才报错
 func (s *MemorySubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if FindCgroupMountpoint(s.Name()) == "" {
+		if res.MemoryLimit != "" {
+			return fmt.Errorf("memory cgroup is not mounted")
+		}
+		return nil
+	}
 	// 获取 subsystem 在虚拟文件系统中的路径
-	if subsysCgroupPtah, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+	if subsysCgroupPtah, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
 		if res.MemoryLimit != "" {
 			// 设置内存限制，即将限制写入到 cgroup 对应目录的 memory.limit_in_bytes 文件中
 			if err := ioutil.WriteFile(path.Join(subsysCgroupPtah, "memory.limit_in_bytes"),
@@ -35,6 +42,9 @@ func (s *MemorySubsystem) Set(cgroupPath string, res *ResourceConfig) error {
 
 // Remove 删除对应节点的限制
 func (s *MemorySubsystem) Remove(cgroupPath string) error {
+	if FindCgroupMountpoint(s.Name()) == "" {
+		return nil
+	}
 	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false)
 	if err != nil {
 		return err
@@ -44,20 +54,37 @@ func (s *MemorySubsystem) Remove(cgroupPath string) error {
 
 // Apply 使进程加入某个 cgroup
 func (s *MemorySubsystem) Apply(cgroupPath string, pid int) error {
+	if FindCgroupMountpoint(s.Name()) == "" {
+		return nil
+	}
 	subsysCgroupPtah, err := GetCgroupPath(s.Name(), cgroupPath, false)
 	if err != nil {
-		return fmt.Errorf("get cgroup %s path error:", cgroupPath, err)
-	}
-	// 写入 tasks 即可
-	if err := ioutil.WriteFile(path.Join(subsysCgroupPtah, "tasks"),
-		[]byte(strconv.Itoa(pid)), 0644); err != nil {
-		fmt.Errorf("set cgroup proc fail %v", err)
-		return err
+		return fmt.Errorf("get cgroup %s path error: %v", cgroupPath, err)
 	}
-	return nil
+	return writeCgroupProcs(subsysCgroupPtah, pid)
 }
 
 // Name 返回对应名称
 func (s *MemorySubsystem) Name() string {
 	return "memory"
 }
+
+// OOMKilled 判断 cgroup 中是否有进程因内存超限被杀死
+// 读取 memory.oom_control 中的 oom_kill 计数，需要 4.13 以上的内核
+func (s *MemorySubsystem) OOMKilled(cgroupPath string) bool {
+	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return false
+	}
+	content, err := ioutil.ReadFile(path.Join(subsysCgroupPath, "memory.oom_control"))
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && fields[0] == "oom_kill" {
+			return fields[1] != "0"
+		}
+	}
+	return false
+}
@@ -0,0 +1,66 @@
+package subsystems
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 15:05 2022/3/30
+ @Description: 进程数的限制
+*/
+
+type PidsSubsystem struct{}
+
+// Set 设置 cgroup 中的最大进程数
+// 没有挂载 pids subsystem 的机器上，只有设置了限制时才报错
+func (s *PidsSubsystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if FindCgroupMountpoint(s.Name()) == "" {
+		if res.PidsLimit != "" {
+			return fmt.Errorf("pids cgroup is not mounted")
+		}
+		return nil
+	}
+	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true)
+	if err != nil {
+		return err
+	}
+	if res.PidsLimit != "" {
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "pids.max"), []byte(res.PidsLimit), 0644); err != nil {
+			return fmt.Errorf("set cgroup pids limit fail %v", err)
+		}
+	}
+	return nil
+}
+
+// Apply 使进程加入某个 cgroup
+func (s *PidsSubsystem) Apply(cgroupPath string, pid int) error {
+	if FindCgroupMountpoint(s.Name()) == "" {
+		return nil
+	}
+	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return writeCgroupProcs(subsysCgroupPath, pid)
+}
+
+// Remove 删除对应的 cgroup
+func (s *PidsSubsystem) Remove(cgroupPath string) error {
+	if FindCgroupMountpoint(s.Name()) == "" {
+		return nil
+	}
+	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	return os.Remove(subsysCgroupPath)
+}
+
+// Name 返回对应名称
+func (s *PidsSubsystem) Name() string {
+	return "pids"
+}
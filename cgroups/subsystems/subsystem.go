@@ -8,9 +8,10 @@ package subsystems
 
 // ResourceConfig 资源传递的限制
 type ResourceConfig struct {
-	MemoryLimit string // 内存限制
-	CpuShare    string // CPU 时间片的权重
-	CpuSet      string // CPU 核心数
+	MemoryLimit string `json:"memory_limit"` // 内存限制
+	CpuShare    string `json:"cpu_share"`    // CPU 时间片的权重
+	CpuSet      string `json:"cpu_set"`      // CPU 核心数
+	PidsLimit   string `json:"pids_limit"`   // 最大进程数，max 表示不限制
 }
 
 // Subsystem 接口，对其资源限制方法的规范
@@ -23,11 +24,26 @@ type Subsystem interface {
 	Remove(path string) error                   // 移除某个 cgroup
 }
 
+// 根节点不是 v1 hierarchy 挂载点的 subsystem 实现该接口，如回退到 cgroup v2 的 freezer
+type rootResolver interface {
+	root() string
+}
+
+// Root 返回 subsystem 的 cgroup 根节点所在的目录，没有挂载时为空
+func Root(s Subsystem) string {
+	if r, ok := s.(rootResolver); ok {
+		return r.root()
+	}
+	return FindCgroupMountpoint(s.Name())
+}
+
 // SubsystemsIns 通过不同的 subsystem 初始化实例创建资源限制处理链数组
 var (
 	SubsystemsIns = []Subsystem{
 		&CpusetSubSystem{},
 		&MemorySubsystem{},
 		&CpuSubsystem{},
+		&FreezerSubsystem{},
+		&PidsSubsystem{},
 	}
 )
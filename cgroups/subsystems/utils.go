@@ -4,8 +4,10 @@ import (
 	"bufio"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"io/ioutil"
 	"os"
 	"path"
+	"strconv"
 	"strings"
 )
 
@@ -41,15 +43,27 @@ func FindCgroupMountpoint(subsystem string) string {
 	return ""
 }
 
-// GetCgroupPath 获取在 cgroup 在文件系统中的绝对路径
+// 将整个进程加入 cgroup，写入 cgroup.procs 会移动进程的所有线程
+// 写入 tasks 只移动 TID 等于 pid 的线程，多线程的 init 可能在其它线程上 exec 用户命令
+func writeCgroupProcs(subsysCgroupPath string, pid int) error {
+	if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return fmt.Errorf("set cgroup proc fail %v", err)
+	}
+	return nil
+}
+
+// GetCgroupPath 获取在 cgroup 在文件系统中的绝对路径，subsystem 没有挂载时报错
 func GetCgroupPath(subsystem string, cgroupPath string, autoCreate bool) (string, error) {
 	cgroupRoot:=FindCgroupMountpoint(subsystem)
+	if cgroupRoot == "" {
+		return "", fmt.Errorf("%s cgroup is not mounted", subsystem)
+	}
 	// 查看路径是否正确 或者 自动创建的，则不允许存在
 	if _,err:=os.Stat(path.Join(cgroupRoot,cgroupPath));err==nil||
 		(autoCreate&&os.IsNotExist(err)){
 		// 如果文件不存在，就证明自动创建
 		if os.IsNotExist(err){
-			if err:=os.Mkdir(path.Join(cgroupRoot,cgroupPath),0755);err!=nil{
+			if err:=os.MkdirAll(path.Join(cgroupRoot,cgroupPath),0755);err!=nil{
 				return "",fmt.Errorf("error create cgroup:%v",err)
 			}
 			logrus.Infof("Create Cgroup file succeess: %s",path.Join(cgroupRoot,cgroupPath))
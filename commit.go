@@ -1,10 +1,12 @@
 package main
 
 import (
+	"copyDocker/archive"
 	"copyDocker/container"
 	"fmt"
 	"github.com/sirupsen/logrus"
-	"os/exec"
+	"io/ioutil"
+	"os"
 )
 
 /*
@@ -14,13 +16,54 @@ import (
 */
 
 // 打包函数具体方法的实现
-func commitContainer(containerName, imageName string) {
-	mntUrl := fmt.Sprintf(container.MntURL, containerName) + "/"
-	imageTar := container.RootURL + "/" + imageName + ".tar"
+// 镜像继承容器的标签，labels 中的同名标签优先
+func commitContainer(containerName, imageName string, labels map[string]string) error {
+	if err := container.ValidateImageName(imageName); err != nil {
+		return err
+	}
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	mntUrl, err := container.MountWorkSpace(info.ID, info.Image)
+	if err != nil {
+		return err
+	}
+	imageTar := container.ImageTarURL(imageName)
 	logrus.Infof("tar image: %s", imageTar)
-	// tar -czf /root/${}.tar -C .
-	if _, err := exec.Command("tar", "-czf", imageTar, "-C", mntUrl, ".").
-		CombinedOutput(); err != nil {
-		logrus.Errorf("Tar folder %s error:%v", container.MntURL, err)
+	// prune 会清理残留的临时文件，打包期间持有镜像的共享锁
+	unlock, err := container.LockImages(false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	// 先写入临时文件，打包完成后再重命名，避免留下不完整的镜像
+	tmpFile, err := ioutil.TempFile(container.ImageStoreURL, ".commit-")
+	if err != nil {
+		return fmt.Errorf("create temp file error %v", err)
+	}
+	defer os.Remove(tmpFile.Name())
+	// 相当于 tar -czf ${root}/images/${}.tar -C ${state}/mnt/${} .
+	err = archive.Tar(mntUrl, ".", tmpFile, &archive.TarOptions{
+		Compression:   archive.Gzip,
+		OneFileSystem: true,
+	})
+	tmpFile.Close()
+	if err != nil {
+		return fmt.Errorf("tar folder %s error %v", mntUrl, err)
+	}
+	if err := os.Rename(tmpFile.Name(), imageTar); err != nil {
+		return fmt.Errorf("rename %s to %s error %v", tmpFile.Name(), imageTar, err)
+	}
+
+	config := &container.ImageConfig{Labels: mergeLabels(info.Labels, labels)}
+	if info.Config != nil {
+		config.Env = info.Config.Env
+	}
+	config.StopSignal = info.StopSignal
+	if err := container.SaveImageConfig(imageName, config); err != nil {
+		return fmt.Errorf("save config of image %s error %v", imageName, err)
 	}
+	return nil
 }
@@ -0,0 +1,78 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"syscall"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 10:40 2022/3/27
+ @Description: 父进程通过管道传递给容器 init 进程的配置
+*/
+
+// Mount 容器内的一个挂载
+type Mount struct {
+	Source      string  `json:"source"`
+	Destination string  `json:"destination"`
+	Type        string  `json:"type"`
+	Flags       uintptr `json:"flags"`
+	Data        string  `json:"data"`
+}
+
+// InitConfig init 进程的配置，以 json 的形式通过 fd 3 的管道传递
+// 命令以数组传递，不会因为参数中的空格被拆开
+type InitConfig struct {
+	Args     []string `json:"args"`     // 用户命令及参数
+	Env      []string `json:"env"`      // 环境变量
+	Cwd      string   `json:"cwd"`      // 工作目录
+	Hostname string   `json:"hostname"` // 主机名
+	Mounts   []Mount  `json:"mounts"`   // pivot_root 之后的挂载
+	User     string   `json:"user"`     // 运行命令的用户，user[:group] 或 uid[:gid]
+	Init     bool     `json:"init"`     // 是否保留 init 作为 1 号进程，而不是 exec 用户命令
+}
+
+// DefaultMounts 容器内默认的挂载
+// proc 以便后续使用 ps 等系统命令查看当前进程资源的情况，tmpfs 挂载到 /dev 下
+var DefaultMounts = []Mount{
+	{
+		Source:      "proc",
+		Destination: "/proc",
+		Type:        "proc",
+		Flags:       syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV,
+	},
+	{
+		Source:      "tmpfs",
+		Destination: "/dev",
+		Type:        "tmpfs",
+		Flags:       syscall.MS_NOSUID | syscall.MS_STRICTATIME,
+		Data:        "mode=755",
+	},
+}
+
+// DefaultPathEnv 容器默认的 PATH，不继承宿主机的环境变量
+const DefaultPathEnv = "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"
+
+// SendInitConfig 将配置写入管道并关闭，init 进程读到 EOF 后开始初始化
+func SendInitConfig(config *InitConfig, writePipe *os.File) error {
+	defer writePipe.Close()
+	if err := json.NewEncoder(writePipe).Encode(config); err != nil {
+		return fmt.Errorf("send init config error %v", err)
+	}
+	return nil
+}
+
+// 从 fd 3 的管道中读取配置
+func readInitConfig() (*InitConfig, error) {
+	// index 为 3 的文件描述符，也就是传递进来管道的一端
+	pipe := os.NewFile(uintptr(3), "pipe")
+	defer pipe.Close()
+
+	var config InitConfig
+	if err := json.NewDecoder(pipe).Decode(&config); err != nil {
+		return nil, fmt.Errorf("init read pipe error %v", err)
+	}
+	return &config, nil
+}
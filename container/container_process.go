@@ -1,11 +1,13 @@
 package container
 
 import (
+	"copyDocker/cgroups/subsystems"
+	"encoding/json"
 	"fmt"
-	"github.com/sirupsen/logrus"
 	"os"
 	"os/exec"
 	"syscall"
+	"time"
 )
 
 /*
@@ -15,27 +17,84 @@ import (
 */
 
 var (
-	RUNNING             string = "running"
-	STOP                string = "stop"
-	Exit                string = "exited"
-	DefaultInfoLocation string = "/var/run/copyDocker/%s/"
-	ConfigName          string = "config.json"
-	ContainerLogFile    string = "container.log"
-	MntURL              string = "/root/mnt/%s"
-	RootURL             string = "/root"
-	WriteLayerUrl       string = "/root/writeLayer/%s"
+	RUNNING          string = "running"
+	STOP             string = "stop"
+	Exit             string = "exited"
+	RESTARTING       string = "restarting"
+	PAUSED           string = "paused"
+	ConfigName       string = "config.json"
+	ContainerLogFile string = "container.log"
 )
 
 // ContainerInfo 存储容器的信息
 type ContainerInfo struct {
-	Pid         string   `json:"pid"`          // 容器的init进程在宿主机上对应的PID
-	ID          string   `json:"id"`           // 容器ID
-	Name        string   `json:"name"`         // 容器名
-	Command     string   `json:"command"`      // 容器内 init 进程的运行命令
-	CreatedTime string   `json:"created_time"` // 创建时间
-	Status      string   `json:"status"`       // 容器状态
-	Volume      string   `json:"volume"`       //容器的数据卷
-	PortMapping []string `json:"port_mapping"`
+	Pid         string      `json:"pid"`          // 容器的init进程在宿主机上对应的PID
+	ID          string      `json:"id"`           // 容器ID
+	Name        string      `json:"name"`         // 容器名
+	Command     CommandArgs `json:"command"`      // 容器内 init 进程的运行命令
+	CreatedTime string      `json:"created_time"` // 创建时间
+	Status      string      `json:"status"`       // 容器状态
+	Volume      string      `json:"volume"`       //容器的数据卷
+	Image       string      `json:"image"`        // 容器使用的镜像名
+	PortMapping []string    `json:"port_mapping"`
+
+	Labels map[string]string `json:"labels"` // 用户设置的标签
+
+	AnonymousVolumes []string   `json:"anonymous_volumes"` // 匿名数据卷在宿主机上的目录，rm -v 时删除
+	Endpoints        []Endpoint `json:"endpoints"`         // 连接的网络端点，rm 时据此清理
+
+	PidStartTime string    `json:"pid_start_time"` // init 进程的启动时间，用于判断 PID 是否被复用
+	ExitCode     int       `json:"exit_code"`      // 退出码，未知时为 -1
+	OOMKilled    bool      `json:"oom_killed"`     // 是否因内存超限被杀死
+	StartedAt    time.Time `json:"started_at"`     // 启动时间
+	FinishedAt   time.Time `json:"finished_at"`    // 退出时间
+	MonitorPid   string    `json:"monitor_pid"`    // 等待容器退出的 monitor 进程
+
+	MonitorStartTime string `json:"monitor_start_time"` // monitor 进程的启动时间
+
+	RestartPolicy   RestartPolicy `json:"restart_policy"`   // 重启策略
+	RestartCount    int           `json:"restart_count"`    // monitor 重启容器的次数
+	ManuallyStopped bool          `json:"manually_stopped"` // 是否被 stop，被 stop 的容器不会重启
+	StopSignal      string        `json:"stop_signal"`      // stop 时发送的信号，默认为 SIGTERM
+
+	// 创建容器时的配置，start 时据此重新创建容器
+	Tty         bool                       `json:"tty"`           // 是否交互运行
+	AutoRemove  bool                       `json:"auto_remove"`   // 退出后是否删除容器
+	LogMaxSize  int64                      `json:"log_max_size"`  // 单个日志文件的最大字节数
+	LogMaxFiles int                        `json:"log_max_files"` // 最多保留的日志文件数
+	Resource    *subsystems.ResourceConfig `json:"resource"`      // 资源限制
+	Config      *InitConfig                `json:"config"`        // init 进程的配置
+}
+
+// CommandArgs 容器的运行命令
+// 之前版本将各个参数直接拼接（没有分隔符）为一个字符串保存，无法还原出原来的参数，
+// 读取时整体作为一个参数，之后以数组的形式写回
+type CommandArgs []string
+
+func (c *CommandArgs) UnmarshalJSON(data []byte) error {
+	var command string
+	if err := json.Unmarshal(data, &command); err == nil {
+		*c = CommandArgs{}
+		if command != "" {
+			*c = CommandArgs{command}
+		}
+		return nil
+	}
+	var args []string
+	if err := json.Unmarshal(data, &args); err != nil {
+		return err
+	}
+	*c = args
+	return nil
+}
+
+// Endpoint 容器连接到网络的端点，删除容器时据此删除 veth 设备、端口映射并释放 IP
+type Endpoint struct {
+	ID          string   `json:"id"`
+	Network     string   `json:"network"`      // 网络名
+	Device      string   `json:"device"`       // 宿主机一端的 veth 设备名
+	IPAddress   string   `json:"ip_address"`   // 分配给容器的 IP
+	PortMapping []string `json:"port_mapping"` // 端口映射，如 80:80
 }
 
 // NewParentProcess 父进程
@@ -43,16 +102,29 @@ type ContainerInfo struct {
 这里的/proc/self/exe 调用中，/proc/self/ 指当前运行进程自己的环境，那么后面跟个exe，
 就是自己调用了自己
 */
-func NewParentProcess(tty bool, volume, containerName,
-	imageName string, envSlice []string) (*exec.Cmd, *os.File) {
+// 返回的两个管道分别用于向 init 传递配置，以及读取 init 的同步消息
+func NewParentProcess(tty bool, volume, containerID,
+	imageName string) (*exec.Cmd, *os.File, *os.File, error) {
 
 	readPipe, writePipe, err := NewPipe()
 	if err != nil {
-		logrus.Errorf("New pipe error %v", err)
-		return nil, nil
+		return nil, nil, nil, fmt.Errorf("new pipe error %v", err)
+	}
+	syncReadPipe, syncWritePipe, err := NewPipe()
+	if err != nil {
+		readPipe.Close()
+		writePipe.Close()
+		return nil, nil, nil, fmt.Errorf("new sync pipe error %v", err)
+	}
+	// 创建失败时关闭全部管道
+	closePipes := func() {
+		for _, f := range []*os.File{readPipe, writePipe, syncReadPipe, syncWritePipe} {
+			f.Close()
+		}
 	}
 
-	// 这里相当于自己调用自己,即fork，并且跟上参数 init $command，也就进入了 initCommand
+	// 这里相当于自己调用自己,即fork，并且跟上参数 init，也就进入了 initCommand
+	// 用户命令、环境变量等通过管道以 json 传递
 	cmd := exec.Command("/proc/self/exe", "init")
 	// 设置隔离
 	cmd.SysProcAttr = &syscall.SysProcAttr{
@@ -65,33 +137,25 @@ func NewParentProcess(tty bool, volume, containerName,
 		cmd.Stderr = os.Stderr
 		cmd.Stdout = os.Stdout
 	} else {
-		// 输出至对应的 log 文件
-		dirURL := fmt.Sprintf(DefaultInfoLocation, containerName)
+		// 输出由调用者重定向至对应的 log 文件
+		dirURL := fmt.Sprintf(DefaultInfoLocation, containerID)
 		if err := os.MkdirAll(dirURL, 0622); err != nil {
-			logrus.Errorf("NewParentProcess mkdir %s error %v.", dirURL, err)
-			return nil, nil
-		}
-		stdLogFilePath := dirURL + ContainerLogFile
-		stdLogFile, err := os.Create(stdLogFilePath)
-		if err != nil {
-			logrus.Errorf("NewParentProcess create file %s error %v", stdLogFilePath, err)
-			return nil, nil
+			closePipes()
+			return nil, nil, nil, fmt.Errorf("mkdir %s error %v", dirURL, err)
 		}
-		// 重定向输出
-		cmd.Stdout = stdLogFile
-
 	}
 
 	// 传入管道读入端，即带着这个文件句柄去创建子进程
-	// 进程默认会有三个文件描述，标准输入、输出、错误。所以这里要绑定一个额外的文件描述符
-	cmd.ExtraFiles = []*os.File{readPipe}
+	// 进程默认会有三个文件描述，标准输入、输出、错误。所以这里要绑定额外的文件描述符
+	// fd 3 为配置管道的读端，fd 4 为同步管道的写端
+	cmd.ExtraFiles = []*os.File{readPipe, syncWritePipe}
 
-	// 添加环境
-	cmd.Env = append(os.Environ(), envSlice...)
-
-	NewWorkSpace(volume, imageName, containerName)
-	cmd.Dir = fmt.Sprintf(MntURL, containerName)
-	return cmd, writePipe
+	if err := NewWorkSpace(volume, imageName, containerID); err != nil {
+		closePipes()
+		return nil, nil, nil, fmt.Errorf("new workspace error %v", err)
+	}
+	cmd.Dir = fmt.Sprintf(MntURL, containerID)
+	return cmd, writePipe, syncReadPipe, nil
 }
 
 // NewPipe 创建管道，对用户参数的缓存，具有 4K 的缓冲区
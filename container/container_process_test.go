@@ -0,0 +1,60 @@
+package container
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestContainerInfoCommandCompat(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		want CommandArgs
+	}{
+		{
+			// 之前版本以 strings.Join(commandArray, "") 保存 run busybox sh -c top 的命令
+			name: "legacy string",
+			data: `{"pid":"","id":"1234567890","name":"web","command":"sh-ctop","created_time":"2022-03-20 16:36:00","status":"stop","volume":"","port_mapping":null}`,
+			want: CommandArgs{"sh-ctop"},
+		},
+		{
+			name: "legacy single argument",
+			data: `{"id":"1234567890","command":"top"}`,
+			want: CommandArgs{"top"},
+		},
+		{
+			name: "legacy empty string",
+			data: `{"id":"1234567890","command":""}`,
+			want: CommandArgs{},
+		},
+		{
+			name: "array",
+			data: `{"id":"1234567890","command":["sh","-c","echo a b"]}`,
+			want: CommandArgs{"sh", "-c", "echo a b"},
+		},
+		{
+			name: "missing",
+			data: `{"id":"1234567890"}`,
+			want: nil,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var info ContainerInfo
+			if err := json.Unmarshal([]byte(tt.data), &info); err != nil {
+				t.Fatalf("unmarshal error %v", err)
+			}
+			if !reflect.DeepEqual(info.Command, tt.want) {
+				t.Errorf("command = %q, want %q", info.Command, tt.want)
+			}
+		})
+	}
+}
+
+func TestContainerInfoCommandInvalid(t *testing.T) {
+	var info ContainerInfo
+	if err := json.Unmarshal([]byte(`{"command":42}`), &info); err == nil {
+		t.Errorf("expected error for numeric command")
+	}
+}
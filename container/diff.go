@@ -0,0 +1,176 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"syscall"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 15:02 2022/3/22
+ @Description: 通过可写层计算容器相对镜像的文件系统变更
+*/
+
+// 变更的种类，与 docker diff 的输出保持一致
+const (
+	ChangeAdd    = "A"
+	ChangeModify = "C"
+	ChangeDelete = "D"
+)
+
+const (
+	// aufs 中删除文件时，会在可写层创建 .wh.${name} 的 whiteout 文件
+	aufsWhiteoutPrefix = ".wh."
+	// aufs 自己的元数据文件、目录，如 .wh..wh.plnk .wh..wh.aufs
+	aufsMetaPrefix = ".wh..wh."
+	// 目录下存在该文件，表示该目录为 opaque，即下层的内容全部被隐藏
+	aufsOpaqueMarker = ".wh..wh..opq"
+	// overlay 中 opaque 目录通过该 xattr 标记
+	overlayOpaqueXattr = "trusted.overlay.opaque"
+)
+
+// Change 容器相对于镜像的一项变更
+type Change struct {
+	Path string `json:"path"` // 容器内的绝对路径
+	Kind string `json:"kind"` // A C D
+}
+
+// ContainerChanges 遍历容器的可写层 ${root}/writeLayer/${id}，
+// 与镜像的只读层 ${root}/images/${image} 对比，得到新增、修改、删除的文件
+func ContainerChanges(containerID, imageName string) ([]Change, error) {
+	lowerURL := ""
+	if imageName != "" {
+		lowerURL = ImageLayerURL(imageName)
+	}
+	return layerChanges(fmt.Sprintf(WriteLayerUrl, containerID), lowerURL)
+}
+
+// 对比可写层与只读层，只读层为空时可写层中的文件都是新增的
+func layerChanges(writeURL, lowerURL string) ([]Change, error) {
+	if _, err := os.Stat(writeURL); err != nil {
+		return nil, fmt.Errorf("stat write layer %s error %v", writeURL, err)
+	}
+
+	var changes []Change
+	err := filepath.Walk(writeURL, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(writeURL, p)
+		if err != nil || rel == "." {
+			return err
+		}
+		dir, name := filepath.Split(rel)
+
+		// aufs 的元数据，.wh..wh..opq 由所在目录统一处理
+		if strings.HasPrefix(name, aufsMetaPrefix) {
+			if info.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// aufs whiteout，表示下层对应的文件被删除
+		if strings.HasPrefix(name, aufsWhiteoutPrefix) {
+			changes = append(changes, Change{
+				Path: "/" + filepath.Join(dir, strings.TrimPrefix(name, aufsWhiteoutPrefix)),
+				Kind: ChangeDelete,
+			})
+			return nil
+		}
+		// overlay whiteout，为设备号 0/0 的字符设备
+		if isOverlayWhiteout(info) {
+			changes = append(changes, Change{Path: "/" + rel, Kind: ChangeDelete})
+			return nil
+		}
+
+		kind := ChangeAdd
+		var lowerInfo os.FileInfo
+		if lowerURL != "" {
+			lowerInfo = lstatInLayer(lowerURL, rel)
+		}
+		if lowerInfo != nil {
+			kind = ChangeModify
+		}
+		changes = append(changes, Change{Path: "/" + rel, Kind: kind})
+
+		// opaque 目录会隐藏下层的全部内容，可写层中不存在的都视为删除
+		if info.IsDir() && lowerInfo != nil && lowerInfo.IsDir() && isOpaqueDir(p) {
+			deleted, err := opaqueDeletes(p, filepath.Join(lowerURL, rel), rel)
+			if err != nil {
+				return err
+			}
+			changes = append(changes, deleted...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Path < changes[j].Path
+	})
+	return changes, nil
+}
+
+// 在只读层中查找文件，不存在时返回 nil
+// 只读层中的符号链接指向宿主机上的路径，因此逐级使用 Lstat，不跟随符号链接
+// 中间的路径不是目录时，只读层中的内容不会与可写层的目录合并，同样视为不存在
+func lstatInLayer(layer, rel string) os.FileInfo {
+	p := layer
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		p = filepath.Join(p, part)
+		info, err := os.Lstat(p)
+		if err != nil {
+			return nil
+		}
+		if i == len(parts)-1 {
+			return info
+		}
+		if !info.IsDir() {
+			return nil
+		}
+	}
+	return nil
+}
+
+// 判断是否为 overlay 的 whiteout 文件
+func isOverlayWhiteout(info os.FileInfo) bool {
+	if info.Mode()&os.ModeCharDevice == 0 {
+		return false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stat.Rdev == 0
+}
+
+// 判断目录是否为 opaque，兼容 aufs 与 overlay 两种标记
+func isOpaqueDir(dir string) bool {
+	if _, err := os.Lstat(filepath.Join(dir, aufsOpaqueMarker)); err == nil {
+		return true
+	}
+	buf := make([]byte, 1)
+	n, err := syscall.Getxattr(dir, overlayOpaqueXattr, buf)
+	return err == nil && n == 1 && buf[0] == 'y'
+}
+
+// 列出被 opaque 目录隐藏的下层文件
+func opaqueDeletes(upperDir, lowerDir, rel string) ([]Change, error) {
+	lowerFiles, err := ioutil.ReadDir(lowerDir)
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	for _, f := range lowerFiles {
+		if _, err := os.Lstat(filepath.Join(upperDir, f.Name())); err == nil {
+			continue
+		}
+		changes = append(changes, Change{Path: "/" + filepath.Join(rel, f.Name()), Kind: ChangeDelete})
+	}
+	return changes, nil
+}
@@ -0,0 +1,170 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+// 层中的一项，目录以 / 结尾，符号链接为 name->target
+// wh: 开头的为 overlay 的 whiteout 字符设备，opq: 开头的为带 trusted.overlay.opaque 的目录
+func createLayer(t *testing.T, dir string, entries []string) {
+	for _, entry := range entries {
+		switch {
+		case strings.HasPrefix(entry, "wh:"):
+			p := filepath.Join(dir, strings.TrimPrefix(entry, "wh:"))
+			if err := syscall.Mknod(p, syscall.S_IFCHR, 0); err != nil {
+				t.Skipf("create overlay whiteout error %v", err)
+			}
+		case strings.HasPrefix(entry, "opq:"):
+			p := filepath.Join(dir, strings.TrimPrefix(entry, "opq:"))
+			if err := os.MkdirAll(p, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := syscall.Setxattr(p, overlayOpaqueXattr, []byte("y"), 0); err != nil {
+				t.Skipf("set %s error %v", overlayOpaqueXattr, err)
+			}
+		case strings.Contains(entry, "->"):
+			kv := strings.SplitN(entry, "->", 2)
+			if err := os.Symlink(kv[1], filepath.Join(dir, kv[0])); err != nil {
+				t.Fatal(err)
+			}
+		case strings.HasSuffix(entry, "/"):
+			if err := os.MkdirAll(filepath.Join(dir, entry), 0755); err != nil {
+				t.Fatal(err)
+			}
+		default:
+			if err := ioutil.WriteFile(filepath.Join(dir, entry), []byte(entry), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+}
+
+func TestLayerChanges(t *testing.T) {
+	tests := []struct {
+		name  string
+		lower []string
+		upper []string
+		want  []Change
+	}{
+		{
+			name:  "added",
+			lower: []string{"bin/", "bin/sh"},
+			upper: []string{"new", "bin/", "bin/ls"},
+			want:  []Change{{"/bin", ChangeModify}, {"/bin/ls", ChangeAdd}, {"/new", ChangeAdd}},
+		},
+		{
+			name:  "changed",
+			lower: []string{"etc/", "etc/passwd"},
+			upper: []string{"etc/", "etc/passwd"},
+			want:  []Change{{"/etc", ChangeModify}, {"/etc/passwd", ChangeModify}},
+		},
+		{
+			name:  "aufs whiteout",
+			lower: []string{"bin/", "bin/sh"},
+			upper: []string{"bin/", "bin/.wh.sh"},
+			want:  []Change{{"/bin", ChangeModify}, {"/bin/sh", ChangeDelete}},
+		},
+		{
+			name:  "aufs opaque dir",
+			lower: []string{"data/", "data/a", "data/b"},
+			upper: []string{"data/", "data/.wh..wh..opq", "data/b", "data/c"},
+			want: []Change{
+				{"/data", ChangeModify}, {"/data/a", ChangeDelete}, {"/data/b", ChangeModify}, {"/data/c", ChangeAdd},
+			},
+		},
+		{
+			name:  "aufs metadata",
+			upper: []string{".wh..wh.plnk/", ".wh..wh.plnk/1.2", ".wh..wh.aufs", "file"},
+			want:  []Change{{"/file", ChangeAdd}},
+		},
+		{
+			name:  "overlay whiteout",
+			lower: []string{"tmp/", "tmp/x"},
+			upper: []string{"tmp/", "wh:tmp/x"},
+			want:  []Change{{"/tmp", ChangeModify}, {"/tmp/x", ChangeDelete}},
+		},
+		{
+			name:  "overlay opaque dir",
+			lower: []string{"var/", "var/a"},
+			upper: []string{"opq:var/", "var/b"},
+			want:  []Change{{"/var", ChangeModify}, {"/var/a", ChangeDelete}, {"/var/b", ChangeAdd}},
+		},
+		{
+			// 只读层中的绝对路径符号链接不能指向宿主机
+			name:  "absolute symlink in lower",
+			lower: []string{"etc->/etc"},
+			upper: []string{"etc/", "etc/passwd"},
+			want:  []Change{{"/etc", ChangeModify}, {"/etc/passwd", ChangeAdd}},
+		},
+		{
+			name:  "dangling symlink in lower",
+			lower: []string{"link->/copyDocker-no-such-file"},
+			upper: []string{"link"},
+			want:  []Change{{"/link", ChangeModify}},
+		},
+		{
+			name:  "symlink in upper",
+			lower: []string{"data/", "data/a"},
+			upper: []string{"data/", "data/.wh..wh..opq", "data/a->/copyDocker-no-such-file"},
+			want:  []Change{{"/data", ChangeModify}, {"/data/a", ChangeModify}},
+		},
+		{
+			name:  "opaque dir replacing symlink",
+			lower: []string{"etc->/etc"},
+			upper: []string{"etc/", "etc/.wh..wh..opq", "etc/hosts"},
+			want:  []Change{{"/etc", ChangeModify}, {"/etc/hosts", ChangeAdd}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "copyDocker-diff")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			lower, upper := filepath.Join(dir, "lower"), filepath.Join(dir, "upper")
+			for _, d := range []string{lower, upper} {
+				if err := os.Mkdir(d, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			createLayer(t, lower, tt.lower)
+			createLayer(t, upper, tt.upper)
+
+			got, err := layerChanges(upper, lower)
+			if err != nil {
+				t.Fatalf("layerChanges error %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("layerChanges() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLayerChangesWithoutImage(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copyDocker-diff")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	createLayer(t, dir, []string{"etc/", "etc/passwd"})
+
+	got, err := layerChanges(dir, "")
+	if err != nil {
+		t.Fatalf("layerChanges error %v", err)
+	}
+	want := []Change{{"/etc", ChangeAdd}, {"/etc/passwd", ChangeAdd}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("layerChanges() = %v, want %v", got, want)
+	}
+	if _, err := layerChanges(filepath.Join(dir, "missing"), ""); err == nil {
+		t.Errorf("layerChanges of missing write layer want error")
+	}
+}
@@ -0,0 +1,126 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 09:30 2022/3/24
+ @Description: 镜像在 ${root}/images 下的存储位置
+*/
+
+// DefaultImageTag 未指定 tag 时使用的默认标签
+const DefaultImageTag = "latest"
+
+// 镜像名的格式，名字与标签都不能以 . 开头、不能包含路径分隔符，保证拼接出的路径在 ${root}/images 之下
+var validImageName = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*(:[a-zA-Z0-9_][a-zA-Z0-9_.-]{0,127})?$`)
+
+// ValidateImageName 校验镜像名，import、commit、run 在拼接镜像路径之前调用
+func ValidateImageName(image string) error {
+	if !validImageName.MatchString(image) {
+		return fmt.Errorf("invalid image name %q, only [a-z0-9][a-z0-9._-]*(:tag)? is allowed", image)
+	}
+	return nil
+}
+
+// ParseImageName 将 name:tag 形式的镜像名拆分为名字与标签
+func ParseImageName(image string) (string, string) {
+	i := strings.LastIndex(image, ":")
+	// 冒号在最后一个 / 之前时，是仓库地址中的端口
+	if i == -1 || i < strings.LastIndex(image, "/") {
+		return image, DefaultImageTag
+	}
+	return image[:i], image[i+1:]
+}
+
+// ImageStoreName 镜像在 ${root}/images 下存储的名字
+// latest 标签直接使用镜像名，兼容之前的 busybox.tar
+// 其余标签使用 _ 连接，避免 : 与 aufs dirs 参数的分隔符冲突
+func ImageStoreName(image string) string {
+	name, tag := ParseImageName(image)
+	name = strings.Replace(name, "/", "_", -1)
+	if tag == DefaultImageTag {
+		return name
+	}
+	return name + "_" + tag
+}
+
+// ImageTarURL 镜像文件 ${root}/images/${image}.tar
+func ImageTarURL(image string) string {
+	return ImageStoreURL + "/" + ImageStoreName(image) + ".tar"
+}
+
+// ImageLayerURL 镜像解压后的只读层 ${root}/images/${image}
+func ImageLayerURL(image string) string {
+	return ImageStoreURL + "/" + ImageStoreName(image)
+}
+
+// ImageConfigURL 镜像的元数据 ${root}/images/${image}.json
+func ImageConfigURL(image string) string {
+	return ImageStoreURL + "/" + ImageStoreName(image) + ".json"
+}
+
+// LockImages 对镜像目录加锁，返回解锁的函数
+// 启动容器时从解压只读层到写入容器信息之间持有共享锁，prune 清理镜像时持有排它锁，
+// 避免删除正在解压、或已经挂载但还没有记录在容器信息中的只读层
+func LockImages(exclusive bool) (func(), error) {
+	if err := os.MkdirAll(ImageStoreURL, 0755); err != nil {
+		return nil, err
+	}
+	file, err := os.OpenFile(ImageStoreURL+"/.lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	how := syscall.LOCK_SH
+	if exclusive {
+		how = syscall.LOCK_EX
+	}
+	if err := syscall.Flock(int(file.Fd()), how); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("lock images error %v", err)
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// ImageConfig 镜像的元数据，由 commit、import 写入
+type ImageConfig struct {
+	Labels map[string]string `json:"labels"`        // 镜像的标签，run 时被容器继承
+	Env    []string          `json:"env,omitempty"` // 镜像的环境变量，run 时被容器继承
+
+	StopSignal string `json:"stop_signal,omitempty"` // 镜像的 stop 信号，run 没有指定 --stop-signal 时使用
+}
+
+// LoadImageConfig 读取镜像的元数据，没有元数据的镜像返回空的配置
+func LoadImageConfig(image string) (*ImageConfig, error) {
+	config := &ImageConfig{}
+	content, err := ioutil.ReadFile(ImageConfigURL(image))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(content, config); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// SaveImageConfig 写入镜像的元数据
+func SaveImageConfig(image string, config *ImageConfig) error {
+	content, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ImageConfigURL(image), content, 0644)
+}
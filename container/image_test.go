@@ -0,0 +1,37 @@
+package container
+
+import "testing"
+
+func TestValidateImageName(t *testing.T) {
+	tests := []struct {
+		image   string
+		wantErr bool
+	}{
+		{image: "busybox"},
+		{image: "busybox:1.35"},
+		{image: "my-app.v2_1:Latest-x"},
+		{image: "0"},
+		{image: "", wantErr: true},
+		{image: ".", wantErr: true},
+		{image: "..", wantErr: true},
+		{image: "../etc", wantErr: true},
+		{image: ".hidden", wantErr: true},
+		{image: "a/b", wantErr: true},
+		{image: "/abs", wantErr: true},
+		{image: "Busybox", wantErr: true},
+		{image: "busybox:", wantErr: true},
+		{image: "busybox:..", wantErr: true},
+		{image: "busybox:.tag", wantErr: true},
+		{image: "busybox:a/b", wantErr: true},
+		{image: "busybox:a:b", wantErr: true},
+		{image: "busy box", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.image, func(t *testing.T) {
+			err := ValidateImageName(tt.image)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("ValidateImageName(%q) error = %v, wantErr %v", tt.image, err, tt.wantErr)
+			}
+		})
+	}
+}
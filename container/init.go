@@ -7,6 +7,7 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
 	"syscall"
 )
@@ -18,42 +19,89 @@ import (
 */
 
 // RunContainerInitProcess 执行到这里了，也就证明容器所在的进程已经创建出来了，那么，这就是容器的第一个进程
-// 使用mount 挂载proc文件系统，以便后续使用 ps 等系统命令查看当前进程资源的情况
+// 先从管道读取父进程传递的配置，再挂载 rootfs、proc 等，最后执行用户命令
+// 任何一步失败都会通过同步管道告知父进程
 func RunContainerInitProcess() error {
-	cmdArray := readUserCommand()
-	if cmdArray == nil || len(cmdArray) == 0 {
-		return fmt.Errorf("Run container get user command error, cmdArray is nil")
+	syncPipe := openSyncPipe()
+	defer syncPipe.Close()
+
+	err := initContainer(syncPipe)
+	// 执行到这里说明 exec 没有成功
+	if syncErr := writeSyncMessage(syncPipe, SyncMessage{Type: SyncError, Message: err.Error()}); syncErr != nil {
+		logrus.Errorf("Write sync pipe error %v", syncErr)
+	}
+	return err
+}
+
+func initContainer(syncPipe *os.File) error {
+	config, err := readInitConfig()
+	if err != nil {
+		return err
+	}
+	if len(config.Args) == 0 {
+		return fmt.Errorf("Run container get user command error, args is empty")
 	}
 
-	setUpMount()
+	if err := setUpMount(config.Mounts); err != nil {
+		return err
+	}
+
+	if config.Hostname != "" {
+		if err := syscall.Sethostname([]byte(config.Hostname)); err != nil {
+			return fmt.Errorf("set hostname %s error %v", config.Hostname, err)
+		}
+	}
+	// 与 docker 相同，工作目录不存在时以 root 身份创建
+	if config.Cwd != "" {
+		if err := os.MkdirAll(config.Cwd, 0755); err != nil {
+			return fmt.Errorf("create working directory %s error %v", config.Cwd, err)
+		}
+		if err := os.Chdir(config.Cwd); err != nil {
+			return fmt.Errorf("chdir %s error %v", config.Cwd, err)
+		}
+	}
+	// LookPath 使用容器的 PATH 查找命令
+	os.Clearenv()
+	for _, env := range config.Env {
+		if kv := strings.SplitN(env, "=", 2); len(kv) == 2 {
+			os.Setenv(kv[0], kv[1])
+		}
+	}
 
 	// 查找对应文件名的绝对路径
 	// 即 /bin/sh
-	path, err := exec.LookPath(cmdArray[0])
+	path, err := exec.LookPath(config.Args[0])
 	if err != nil {
-		logrus.Errorf("Exec loop path error %v", err)
-		return err
+		return fmt.Errorf("exec look path error %v", err)
 	}
 	logrus.Infof("Find path %s", path)
-	// 注意这里的系统调用，能使在容器中，进行 ps 查看进程时，PID=1为前台进程，而不是init
-	// 该调用会覆盖当前的进程，即覆盖init进程
-	if err := syscall.Exec(path, cmdArray[0:], os.Environ()); err != nil {
-		logrus.Errorf(err.Error())
-	}
-	return nil
-}
 
-func readUserCommand() []string {
-	// index 为 3 的文件描述符，也就是传递进来管道的一端
-	pipe := os.NewFile(uintptr(3), "pipe")
+	var cred *syscall.Credential
+	if config.User != "" {
+		if cred, err = lookupUser(config.User); err != nil {
+			return err
+		}
+	}
 
-	msg, err := ioutil.ReadAll(pipe)
-	if err != nil {
-		logrus.Errorf("init read pipe error %v", err)
-		return nil
+	// 初始化完成，通知父进程
+	if err := writeSyncMessage(syncPipe, SyncMessage{Type: SyncReady}); err != nil {
+		return fmt.Errorf("write sync pipe error %v", err)
+	}
+	// --init 时保留自己作为 1 号进程，负责转发信号与回收僵尸进程
+	if config.Init {
+		return runAsPid1(path, config.Args, cred, syncPipe)
+	}
+	if cred != nil {
+		if err := setUser(cred); err != nil {
+			return err
+		}
+	}
+	// 注意这里的系统调用，能使在容器中，进行 ps 查看进程时，PID=1为前台进程，而不是init
+	// 该调用会覆盖当前的进程，即覆盖init进程，成功后同步管道随之关闭
+	if err := syscall.Exec(path, config.Args, os.Environ()); err != nil {
+		return fmt.Errorf("exec %s error %v", path, err)
 	}
-	msgStr := string(msg)
-	return strings.Split(msgStr, " ")
+	return nil
 }
 
 func pivotRoot(root string) error {
@@ -93,21 +141,85 @@ func pivotRoot(root string) error {
 }
 
 // init 容器时，进行一些了 mount 操作
-func setUpMount() {
+func setUpMount(mounts []Mount) error {
 	// 获取当前的文件路径
 	pwd, err := os.Getwd()
 	if err != nil {
-		logrus.Error("get current location error: %v", err)
-		return
+		return fmt.Errorf("get current location error: %v", err)
 	}
 	logrus.Infof("Current location is %s", pwd)
 	// 将当前进程的 root 切换到当前路径
-	pivotRoot(pwd)
-
-	defaultMountFlags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
-	// 当前进程信息挂载
-	syscall.Mount("proc", "/proc", "proc", uintptr(defaultMountFlags), "")
-	// 将 tmpfs 文件系统挂载到 dev下
-	syscall.Mount("tmpfs", "/dev", "tmpfs",
-		syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755")
+	if err := pivotRoot(pwd); err != nil {
+		return fmt.Errorf("pivot root to %s error: %v", pwd, err)
+	}
+
+	for _, m := range mounts {
+		if err := os.MkdirAll(m.Destination, 0755); err != nil {
+			return fmt.Errorf("mkdir %s error %v", m.Destination, err)
+		}
+		if err := syscall.Mount(m.Source, m.Destination, m.Type, m.Flags, m.Data); err != nil {
+			return fmt.Errorf("mount %s to %s error %v", m.Source, m.Destination, err)
+		}
+	}
+	return nil
+}
+
+// 解析配置的用户，user[:group]，可以是名字或数字 id
+// 名字从容器内的 /etc/passwd、/etc/group 中查找
+func lookupUser(user string) (*syscall.Credential, error) {
+	userPart, groupPart := user, ""
+	if i := strings.Index(user, ":"); i != -1 {
+		userPart, groupPart = user[:i], user[i+1:]
+	}
+
+	uid, gid, err := lookupID("/etc/passwd", userPart)
+	if err != nil {
+		return nil, fmt.Errorf("lookup user %s error %v", userPart, err)
+	}
+	if groupPart != "" {
+		if gid, _, err = lookupID("/etc/group", groupPart); err != nil {
+			return nil, fmt.Errorf("lookup group %s error %v", groupPart, err)
+		}
+	}
+	return &syscall.Credential{Uid: uint32(uid), Gid: uint32(gid), Groups: []uint32{}}, nil
+}
+
+// 切换当前进程的用户
+func setUser(cred *syscall.Credential) error {
+	if err := syscall.Setgroups([]int{}); err != nil {
+		return fmt.Errorf("setgroups error %v", err)
+	}
+	if err := syscall.Setgid(int(cred.Gid)); err != nil {
+		return fmt.Errorf("setgid %d error %v", cred.Gid, err)
+	}
+	if err := syscall.Setuid(int(cred.Uid)); err != nil {
+		return fmt.Errorf("setuid %d error %v", cred.Uid, err)
+	}
+	return nil
+}
+
+// 在 passwd 或 group 格式的文件中查找 name，返回第三、四列的 id
+// name 为数字时直接使用，文件中没有对应记录时第二个 id 为 0
+func lookupID(file, name string) (int, int, error) {
+	content, _ := ioutil.ReadFile(file)
+	id, numErr := strconv.Atoi(name)
+	for _, line := range strings.Split(string(content), "\n") {
+		fields := strings.Split(line, ":")
+		if len(fields) < 3 || (fields[0] != name && fields[2] != name) {
+			continue
+		}
+		first, err := strconv.Atoi(fields[2])
+		if err != nil {
+			continue
+		}
+		second := 0
+		if len(fields) > 3 {
+			second, _ = strconv.Atoi(fields[3])
+		}
+		return first, second, nil
+	}
+	if numErr == nil {
+		return id, 0, nil
+	}
+	return 0, 0, fmt.Errorf("no matching entries in %s", file)
 }
@@ -0,0 +1,126 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 17:20 2022/3/28
+ @Description: 后台容器的日志文件，超过大小后轮转
+*/
+
+// RotateLogWriter 写入容器日志，文件超过 maxSize 后轮转
+// 轮转后的文件依次为 container.log.1、container.log.2 ...，最多保留 maxFiles 个文件
+type RotateLogWriter struct {
+	mu       sync.Mutex
+	path     string
+	maxSize  int64 // 单个文件的最大字节数，0 表示不限制
+	maxFiles int   // 包括当前文件在内最多保留的文件数
+	file     *os.File
+	size     int64
+}
+
+// NewRotateLogWriter 打开日志文件，已存在时追加写入，重新 start 的容器保留之前的日志
+func NewRotateLogWriter(path string, maxSize int64, maxFiles int) (*RotateLogWriter, error) {
+	if maxFiles < 1 {
+		maxFiles = 1
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &RotateLogWriter{path: path, maxSize: maxSize, maxFiles: maxFiles, file: file, size: stat.Size()}, nil
+}
+
+func (w *RotateLogWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.maxSize > 0 && w.size > 0 && w.size+int64(len(p)) > w.maxSize {
+		if err := w.rotate(); err != nil {
+			return 0, err
+		}
+	}
+	n, err := w.file.Write(p)
+	w.size += int64(n)
+	return n, err
+}
+
+// Close 关闭当前的日志文件
+func (w *RotateLogWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.file.Close()
+}
+
+// 依次重命名旧的日志文件，超过 maxFiles 的被覆盖，然后重新创建当前文件
+func (w *RotateLogWriter) rotate() error {
+	w.file.Close()
+	if w.maxFiles > 1 {
+		for i := w.maxFiles - 2; i >= 1; i-- {
+			os.Rename(fmt.Sprintf("%s.%d", w.path, i), fmt.Sprintf("%s.%d", w.path, i+1))
+		}
+		if err := os.Rename(w.path, w.path+".1"); err != nil {
+			return fmt.Errorf("rotate log %s error %v", w.path, err)
+		}
+	}
+	// 与 NewRotateLogWriter 相同的权限，只保留一个文件时清空原来的内容
+	file, err := os.OpenFile(w.path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return fmt.Errorf("create log %s error %v", w.path, err)
+	}
+	w.file, w.size = file, 0
+	return nil
+}
+
+// LogFiles 返回已存在的日志文件，轮转后的文件在前，从最旧的 container.log.N 到当前的 container.log
+func LogFiles(path string) []string {
+	files := []string{}
+	if _, err := os.Stat(path); err == nil {
+		files = append(files, path)
+	}
+	// 轮转后的文件编号连续，从 1 开始依次查找，不依赖容器当前的 maxFiles 配置
+	for i := 1; ; i++ {
+		rotated := fmt.Sprintf("%s.%d", path, i)
+		if _, err := os.Stat(rotated); err != nil {
+			break
+		}
+		files = append([]string{rotated}, files...)
+	}
+	return files
+}
+
+// ParseSize 解析 10k、20m、1g 形式的大小，返回字节数，空字符串为 0
+func ParseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	unit := int64(1)
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "k":
+		unit = 1 << 10
+	case "m":
+		unit = 1 << 20
+	case "g":
+		unit = 1 << 30
+	}
+	num := s
+	if unit != 1 {
+		num = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(num, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size %s", s)
+	}
+	return n * unit, nil
+}
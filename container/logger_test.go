@@ -0,0 +1,180 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestParseSize(t *testing.T) {
+	tests := []struct {
+		size    string
+		want    int64
+		wantErr bool
+	}{
+		{size: "", want: 0},
+		{size: "0", want: 0},
+		{size: "100", want: 100},
+		{size: "10k", want: 10 << 10},
+		{size: "10K", want: 10 << 10},
+		{size: "20m", want: 20 << 20},
+		{size: "1g", want: 1 << 30},
+		{size: "1.5m", wantErr: true},
+		{size: "-1m", wantErr: true},
+		{size: "m", wantErr: true},
+		{size: "10x", wantErr: true},
+		{size: "10mb", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.size, func(t *testing.T) {
+			got, err := ParseSize(tt.size)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseSize(%q) = %d, want error", tt.size, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSize(%q) error %v", tt.size, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSize(%q) = %d, want %d", tt.size, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRotateLogWriter(t *testing.T) {
+	tests := []struct {
+		name     string
+		maxSize  int64
+		maxFiles int
+		writes   []string
+		want     map[string]string // 文件名 -> 内容
+	}{
+		{
+			name:     "unlimited",
+			maxFiles: 3,
+			writes:   []string{"aaaa", "bbbb", "cccc"},
+			want:     map[string]string{"container.log": "aaaabbbbcccc"},
+		},
+		{
+			name:     "rotate and keep max files",
+			maxSize:  8,
+			maxFiles: 3,
+			writes:   []string{"aaaa", "bbbb", "cccc", "dddd", "eeee", "ffff", "gggg"},
+			want: map[string]string{
+				"container.log":   "gggg",
+				"container.log.1": "eeeeffff",
+				"container.log.2": "ccccdddd",
+			},
+		},
+		{
+			name:     "single file truncated",
+			maxSize:  8,
+			maxFiles: 1,
+			writes:   []string{"aaaa", "bbbb", "cccc"},
+			want:     map[string]string{"container.log": "cccc"},
+		},
+		{
+			name:     "oversized write",
+			maxSize:  4,
+			maxFiles: 2,
+			writes:   []string{"aaaaaaaa", "bb"},
+			want: map[string]string{
+				"container.log":   "bb",
+				"container.log.1": "aaaaaaaa",
+			},
+		},
+	}
+	// 轮转后重新创建的文件与第一次创建的文件权限相同，不受 umask 影响
+	defer syscall.Umask(syscall.Umask(0))
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "copyDocker-log")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			path := filepath.Join(dir, "container.log")
+			w, err := NewRotateLogWriter(path, tt.maxSize, tt.maxFiles)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, s := range tt.writes {
+				if _, err := w.Write([]byte(s)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if err := w.Close(); err != nil {
+				t.Fatal(err)
+			}
+
+			files, err := ioutil.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got := map[string]string{}
+			for _, f := range files {
+				content, err := ioutil.ReadFile(filepath.Join(dir, f.Name()))
+				if err != nil {
+					t.Fatal(err)
+				}
+				got[f.Name()] = string(content)
+				if f.Mode().Perm() != 0644 {
+					t.Errorf("mode of %s = %v, want %v", f.Name(), f.Mode().Perm(), os.FileMode(0644))
+				}
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("log files = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLogFiles(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+		want  []string
+	}{
+		{name: "none"},
+		{name: "current only", files: []string{"container.log"}, want: []string{"container.log"}},
+		{
+			name:  "rotated oldest first",
+			files: []string{"container.log", "container.log.1", "container.log.2"},
+			want:  []string{"container.log.2", "container.log.1", "container.log"},
+		},
+		{
+			// 编号不连续的文件不属于当前的轮转
+			name:  "gap",
+			files: []string{"container.log", "container.log.1", "container.log.3"},
+			want:  []string{"container.log.1", "container.log"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "copyDocker-log")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			for _, f := range tt.files {
+				if err := ioutil.WriteFile(filepath.Join(dir, f), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			got := LogFiles(filepath.Join(dir, "container.log"))
+			want := []string{}
+			for _, f := range tt.want {
+				want = append(want, filepath.Join(dir, f))
+			}
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("LogFiles() = %v, want %v", got, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,91 @@
+package container
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 20:15 2022/3/26
+ @Description: 挂载点的查找与卸载
+*/
+
+// MountPoints 从 /proc/self/mountinfo 中找出 dir 及其下所有的挂载点
+func MountPoints(dir string) ([]string, error) {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	dir = filepath.Clean(dir)
+	var mounts []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		// 36 35 98:0 /mnt1 /mnt2 rw,noatime master:1 - ext3 /dev/root rw
+		fields := strings.Split(scanner.Text(), " ")
+		if len(fields) < 5 {
+			continue
+		}
+		mountPoint := unescapeMountPoint(fields[4])
+		if mountPoint == dir || strings.HasPrefix(mountPoint, dir+"/") {
+			mounts = append(mounts, mountPoint)
+		}
+	}
+	return mounts, scanner.Err()
+}
+
+// IsMounted 判断 dir 本身是否为挂载点
+func IsMounted(dir string) bool {
+	mounts, err := MountPoints(dir)
+	if err != nil {
+		return false
+	}
+	for _, m := range mounts {
+		if m == filepath.Clean(dir) {
+			return true
+		}
+	}
+	return false
+}
+
+// UnmountAll 卸载 dir 及其下的所有挂载点，由深至浅
+// 之后再删除目录，就不会误删数据卷等挂载进来的内容
+func UnmountAll(dir string) error {
+	mounts, err := MountPoints(dir)
+	if err != nil {
+		return err
+	}
+	sort.Sort(sort.Reverse(sort.StringSlice(mounts)))
+	for _, m := range mounts {
+		if err := syscall.Unmount(m, syscall.MNT_DETACH); err != nil && err != syscall.EINVAL {
+			return err
+		}
+	}
+	return nil
+}
+
+// mountinfo 中的空格等字符以 \040 形式的八进制转义
+func unescapeMountPoint(s string) string {
+	if !strings.Contains(s, "\\") {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
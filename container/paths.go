@@ -0,0 +1,60 @@
+package container
+
+import (
+	"os"
+	"path/filepath"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 10:10 2022/3/31
+ @Description: 数据目录的布局，可以通过 --root 与 --state 整体迁移
+*/
+
+const (
+	// DefaultRootDir 持久化数据的默认目录：镜像、容器信息与日志、可写层、网络配置
+	DefaultRootDir = "/var/lib/copyDocker"
+	// DefaultStateDir 只在运行期间有效的数据的默认目录：容器文件系统的挂载点等，重启后不再需要
+	DefaultStateDir = "/run/copyDocker"
+
+	// 之前版本使用的目录，供迁移使用
+	LegacyRootURL      = "/root"
+	LegacyInfoLocation = "/var/run/copyDocker"
+)
+
+var (
+	RootDir             string // 持久化数据的目录
+	StateDir            string // 运行期数据的目录
+	ImageStoreURL       string // 镜像文件、镜像元数据与解压出的只读层 ${root}/images
+	ContainersURL       string // 容器信息的目录 ${root}/containers
+	DefaultInfoLocation string // 单个容器的信息与日志 ${root}/containers/${id}/
+	WriteLayerUrl       string // 容器的可写层 ${root}/writeLayer/${id}
+	VolumesURL          string // 匿名数据卷 ${root}/volumes
+	MntURL              string // 容器文件系统的挂载点 ${state}/mnt/${id}
+)
+
+func init() {
+	SetPaths(DefaultRootDir, DefaultStateDir)
+}
+
+// SetPaths 设置持久化数据与运行期数据的目录，所有路径都由这两个目录派生
+func SetPaths(root, state string) {
+	RootDir = filepath.Clean(root)
+	StateDir = filepath.Clean(state)
+	ImageStoreURL = filepath.Join(RootDir, "images")
+	ContainersURL = filepath.Join(RootDir, "containers")
+	DefaultInfoLocation = ContainersURL + "/%s/"
+	WriteLayerUrl = filepath.Join(RootDir, "writeLayer") + "/%s"
+	VolumesURL = filepath.Join(RootDir, "volumes")
+	MntURL = filepath.Join(StateDir, "mnt") + "/%s"
+}
+
+// CreatePaths 创建镜像与容器信息的目录，新的 root 下 import、commit 等命令可以直接使用
+func CreatePaths() error {
+	for _, dir := range []string{ImageStoreURL, ContainersURL} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	return nil
+}
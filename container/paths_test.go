@@ -0,0 +1,50 @@
+package container
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestSetPaths(t *testing.T) {
+	defer SetPaths(DefaultRootDir, DefaultStateDir)
+
+	tests := []struct {
+		name      string
+		root      string
+		state     string
+		wantRoot  string
+		wantState string
+	}{
+		{name: "default", root: DefaultRootDir, state: DefaultStateDir, wantRoot: DefaultRootDir, wantState: DefaultStateDir},
+		{name: "custom", root: "/data/copyDocker", state: "/tmp/copyDocker", wantRoot: "/data/copyDocker", wantState: "/tmp/copyDocker"},
+		{name: "unclean", root: "/data//copyDocker/", state: "/tmp/./copyDocker", wantRoot: "/data/copyDocker", wantState: "/tmp/copyDocker"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			SetPaths(tt.root, tt.state)
+			got := map[string]string{
+				"root":       RootDir,
+				"state":      StateDir,
+				"images":     ImageStoreURL,
+				"containers": ContainersURL,
+				"info":       fmt.Sprintf(DefaultInfoLocation, "id"),
+				"writeLayer": fmt.Sprintf(WriteLayerUrl, "id"),
+				"mnt":        fmt.Sprintf(MntURL, "id"),
+			}
+			want := map[string]string{
+				"root":       tt.wantRoot,
+				"state":      tt.wantState,
+				"images":     tt.wantRoot + "/images",
+				"containers": tt.wantRoot + "/containers",
+				"info":       tt.wantRoot + "/containers/id/",
+				"writeLayer": tt.wantRoot + "/writeLayer/id",
+				"mnt":        tt.wantState + "/mnt/id",
+			}
+			for key, path := range want {
+				if got[key] != path {
+					t.Errorf("%s = %s, want %s", key, got[key], path)
+				}
+			}
+		})
+	}
+}
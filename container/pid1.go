@@ -0,0 +1,76 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"syscall"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 11:20 2022/3/28
+ @Description: --init 时的 1 号进程，启动用户命令，转发信号并回收僵尸进程
+*/
+
+// 作为容器的 1 号进程运行用户命令
+// 1. 转发所有可捕获的信号给用户命令，使 stop 发送的 SIGTERM 能够生效
+// 2. 回收孤儿进程，避免僵尸进程堆积
+// 3. 用户命令退出后，以其退出码退出
+func runAsPid1(path string, args []string, cred *syscall.Credential, syncPipe *os.File) error {
+	// 先注册信号，避免子进程启动后、注册前的 SIGCHLD 丢失
+	signals := make(chan os.Signal, 128)
+	signal.Notify(signals)
+
+	process, err := os.StartProcess(path, args, &os.ProcAttr{
+		Env:   os.Environ(),
+		Files: []*os.File{os.Stdin, os.Stdout, os.Stderr},
+		Sys:   &syscall.SysProcAttr{Credential: cred},
+	})
+	if err != nil {
+		signal.Reset()
+		return fmt.Errorf("start %s error %v", path, err)
+	}
+	// 用户命令已经启动，关闭同步管道通知父进程
+	syncPipe.Close()
+
+	for sig := range signals {
+		switch sig {
+		case syscall.SIGCHLD:
+			if exited, code := reapChildren(process.Pid); exited {
+				os.Exit(code)
+			}
+		case syscall.SIGURG:
+			// go runtime 用于抢占调度的信号，不转发
+		default:
+			syscall.Kill(process.Pid, sig.(syscall.Signal))
+		}
+	}
+	return nil
+}
+
+// 回收所有已退出的子进程，返回用户命令是否退出及其退出码
+func reapChildren(childPid int) (bool, int) {
+	exited, code := false, 0
+	for {
+		var status syscall.WaitStatus
+		pid, err := syscall.Wait4(-1, &status, syscall.WNOHANG, nil)
+		if err == syscall.EINTR {
+			continue
+		}
+		if err != nil || pid <= 0 {
+			return exited, code
+		}
+		if pid == childPid {
+			exited, code = true, ExitCode(status)
+		}
+	}
+}
+
+// ExitCode 进程的退出码，被信号杀死时与 shell 一致为 128+信号值
+func ExitCode(status syscall.WaitStatus) int {
+	if status.Signaled() {
+		return 128 + int(status.Signal())
+	}
+	return status.ExitStatus()
+}
@@ -0,0 +1,27 @@
+package container
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		status syscall.WaitStatus // 低 7 位为信号，8-15 位为退出码
+		want   int
+	}{
+		{name: "success", status: 0, want: 0},
+		{name: "exit 1", status: 1 << 8, want: 1},
+		{name: "exit 255", status: 255 << 8, want: 255},
+		{name: "killed", status: syscall.WaitStatus(syscall.SIGKILL), want: 137},
+		{name: "terminated", status: syscall.WaitStatus(syscall.SIGTERM), want: 143},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ExitCode(tt.status); got != tt.want {
+				t.Errorf("ExitCode(%#x) = %d, want %d", uint32(tt.status), got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,71 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"strings"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 15:10 2022/3/28
+ @Description: 判断容器的进程是否仍然存活
+*/
+
+// ProcessStartTime 读取 /proc/${pid}/stat 中的 starttime，即进程在系统启动后多久被创建
+// PID 被复用时，新进程的 starttime 一定不同
+func ProcessStartTime(pid string) (string, error) {
+	fields, err := processStat(pid)
+	if err != nil {
+		return "", err
+	}
+	// starttime 为第 22 列
+	return fields[19], nil
+}
+
+// 读取 /proc/${pid}/stat，返回从第 3 列（进程状态）开始的各个字段
+func processStat(pid string) ([]string, error) {
+	content, err := ioutil.ReadFile(fmt.Sprintf("/proc/%s/stat", pid))
+	if err != nil {
+		return nil, err
+	}
+	// 进程名中可能包含空格与括号，从最后一个 ) 之后开始解析
+	stat := string(content)
+	fields := strings.Fields(stat[strings.LastIndex(stat, ")")+1:])
+	if len(fields) < 20 {
+		return nil, fmt.Errorf("invalid stat of process %s", pid)
+	}
+	return fields, nil
+}
+
+// IsAlive 判断容器的 init 进程是否仍然存在，且不是复用了该 PID 的其它进程
+func (info *ContainerInfo) IsAlive() bool {
+	if info.Pid == "" {
+		return false
+	}
+	fields, err := processStat(info.Pid)
+	// 僵尸进程已经退出，只是还没有被回收
+	if err != nil || fields[0] == "Z" {
+		return false
+	}
+	// 旧版本没有记录启动时间，只能以进程存在为准
+	return info.PidStartTime == "" || info.PidStartTime == fields[19]
+}
+
+// MonitorAlive 判断等待容器退出的 monitor 进程是否仍然存在
+// monitor 退出前会记录容器的退出状态并清理 cgroup
+func (info *ContainerInfo) MonitorAlive() bool {
+	if info.MonitorPid == "" {
+		return false
+	}
+	fields, err := processStat(info.MonitorPid)
+	if err != nil || fields[0] == "Z" {
+		return false
+	}
+	return info.MonitorStartTime == "" || info.MonitorStartTime == fields[19]
+}
+
+// IsRunning 容器是否处于运行中、暂停或等待重启的状态，这些容器不能被删除
+func (info *ContainerInfo) IsRunning() bool {
+	return info.Status == RUNNING || info.Status == PAUSED || info.Status == RESTARTING
+}
@@ -0,0 +1,84 @@
+package container
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 21:30 2022/3/28
+ @Description: 容器的重启策略
+*/
+
+// 重启策略的名字
+const (
+	RestartNo            = "no"
+	RestartOnFailure     = "on-failure"
+	RestartAlways        = "always"
+	RestartUnlessStopped = "unless-stopped"
+)
+
+// RestartPolicy 容器退出后是否由 monitor 重新启动
+type RestartPolicy struct {
+	Name              string `json:"name"`
+	MaximumRetryCount int    `json:"maximum_retry_count"` // 仅 on-failure 有效，0 表示不限制
+}
+
+// ParseRestartPolicy 解析 no、on-failure[:N]、always、unless-stopped
+func ParseRestartPolicy(policy string) (RestartPolicy, error) {
+	if policy == "" {
+		return RestartPolicy{Name: RestartNo}, nil
+	}
+	parts := strings.SplitN(policy, ":", 2)
+	p := RestartPolicy{Name: parts[0]}
+	switch p.Name {
+	case RestartNo, RestartAlways, RestartUnlessStopped:
+		if len(parts) == 2 {
+			return p, fmt.Errorf("maximum retry count is only valid for %s", RestartOnFailure)
+		}
+	case RestartOnFailure:
+		if len(parts) == 2 {
+			count, err := strconv.Atoi(parts[1])
+			if err != nil || count < 0 {
+				return p, fmt.Errorf("invalid maximum retry count %s", parts[1])
+			}
+			p.MaximumRetryCount = count
+		}
+	default:
+		return p, fmt.Errorf("invalid restart policy %s", policy)
+	}
+	return p, nil
+}
+
+// IsNone 是否不需要重启
+func (p RestartPolicy) IsNone() bool {
+	return p.Name == "" || p.Name == RestartNo
+}
+
+func (p RestartPolicy) String() string {
+	if p.Name == RestartOnFailure && p.MaximumRetryCount > 0 {
+		return fmt.Sprintf("%s:%d", p.Name, p.MaximumRetryCount)
+	}
+	if p.Name == "" {
+		return RestartNo
+	}
+	return p.Name
+}
+
+// ShouldRestart 根据重启策略与退出状态判断容器是否需要重启
+// 被 stop 的容器不会重启；没有常驻的 daemon，always 与 unless-stopped 的区别仅在于此
+func (info *ContainerInfo) ShouldRestart() bool {
+	if info.ManuallyStopped {
+		return false
+	}
+	switch info.RestartPolicy.Name {
+	case RestartAlways, RestartUnlessStopped:
+		return true
+	case RestartOnFailure:
+		max := info.RestartPolicy.MaximumRetryCount
+		return info.ExitCode != 0 && (max == 0 || info.RestartCount < max)
+	}
+	return false
+}
@@ -0,0 +1,71 @@
+package container
+
+import "testing"
+
+func TestParseRestartPolicy(t *testing.T) {
+	tests := []struct {
+		policy  string
+		want    RestartPolicy
+		wantErr bool
+	}{
+		{policy: "", want: RestartPolicy{Name: RestartNo}},
+		{policy: "no", want: RestartPolicy{Name: RestartNo}},
+		{policy: "always", want: RestartPolicy{Name: RestartAlways}},
+		{policy: "unless-stopped", want: RestartPolicy{Name: RestartUnlessStopped}},
+		{policy: "on-failure", want: RestartPolicy{Name: RestartOnFailure}},
+		{policy: "on-failure:3", want: RestartPolicy{Name: RestartOnFailure, MaximumRetryCount: 3}},
+		{policy: "on-failure:0", want: RestartPolicy{Name: RestartOnFailure}},
+		{policy: "on-failure:-1", wantErr: true},
+		{policy: "on-failure:x", wantErr: true},
+		{policy: "always:3", wantErr: true},
+		{policy: "no:1", wantErr: true},
+		{policy: "sometimes", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			got, err := ParseRestartPolicy(tt.policy)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseRestartPolicy(%q) = %+v, want error", tt.policy, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseRestartPolicy(%q) error %v", tt.policy, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRestartPolicy(%q) = %+v, want %+v", tt.policy, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestShouldRestart(t *testing.T) {
+	tests := []struct {
+		name string
+		info ContainerInfo
+		want bool
+	}{
+		{name: "no policy", info: ContainerInfo{ExitCode: 1}},
+		{name: "always", info: ContainerInfo{RestartPolicy: RestartPolicy{Name: RestartAlways}}, want: true},
+		{name: "always but stopped", info: ContainerInfo{RestartPolicy: RestartPolicy{Name: RestartAlways}, ManuallyStopped: true}},
+		{name: "on-failure success", info: ContainerInfo{RestartPolicy: RestartPolicy{Name: RestartOnFailure}}},
+		{name: "on-failure failed", info: ContainerInfo{RestartPolicy: RestartPolicy{Name: RestartOnFailure}, ExitCode: 1}, want: true},
+		{
+			name: "on-failure retries left",
+			info: ContainerInfo{RestartPolicy: RestartPolicy{Name: RestartOnFailure, MaximumRetryCount: 3}, ExitCode: 1, RestartCount: 2},
+			want: true,
+		},
+		{
+			name: "on-failure retries exhausted",
+			info: ContainerInfo{RestartPolicy: RestartPolicy{Name: RestartOnFailure, MaximumRetryCount: 3}, ExitCode: 1, RestartCount: 3},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.info.ShouldRestart(); got != tt.want {
+				t.Errorf("ShouldRestart() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
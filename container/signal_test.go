@@ -0,0 +1,45 @@
+package container
+
+import (
+	"syscall"
+	"testing"
+)
+
+func TestParseSignal(t *testing.T) {
+	tests := []struct {
+		signal  string
+		want    syscall.Signal
+		wantErr bool
+	}{
+		{signal: "SIGTERM", want: syscall.SIGTERM},
+		{signal: "TERM", want: syscall.SIGTERM},
+		{signal: "term", want: syscall.SIGTERM},
+		{signal: "sigkill", want: syscall.SIGKILL},
+		{signal: "15", want: syscall.SIGTERM},
+		{signal: "9", want: syscall.SIGKILL},
+		{signal: "64", want: syscall.Signal(64)},
+		{signal: "0", wantErr: true},
+		{signal: "65", wantErr: true},
+		{signal: "-1", wantErr: true},
+		{signal: "", wantErr: true},
+		{signal: "SIG", wantErr: true},
+		{signal: "SIGFOO", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.signal, func(t *testing.T) {
+			got, err := ParseSignal(tt.signal)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseSignal(%q) = %v, want error", tt.signal, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseSignal(%q) error %v", tt.signal, err)
+			}
+			if got != tt.want {
+				t.Errorf("ParseSignal(%q) = %v, want %v", tt.signal, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,68 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"syscall"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 16:30 2022/3/27
+ @Description: 父进程与 init 进程之间的同步，init 启动失败时父进程能拿到真正的原因
+*/
+
+// init 进程中同步管道的文件描述符，fd 3 为传递配置的管道
+const syncPipeFd = 4
+
+// 同步消息的类型
+const (
+	SyncReady = "ready" // 初始化完成，即将 exec 用户命令
+	SyncError = "error" // 初始化失败
+)
+
+// SyncMessage init 进程通过同步管道发给父进程的消息，每行一个 json
+type SyncMessage struct {
+	Type    string `json:"type"`
+	Message string `json:"message,omitempty"`
+}
+
+// WaitInitReady 父进程等待 init 初始化完成
+// 同步管道在 init exec 用户命令时自动关闭（close-on-exec），
+// 因此读到 ready 之后的 EOF 表示 exec 成功；exec 失败时 init 会再发送 error
+func WaitInitReady(syncPipe *os.File) error {
+	defer syncPipe.Close()
+	decoder := json.NewDecoder(syncPipe)
+	ready := false
+	for {
+		var msg SyncMessage
+		if err := decoder.Decode(&msg); err != nil {
+			if err != io.EOF {
+				return fmt.Errorf("read sync pipe error %v", err)
+			}
+			if !ready {
+				return fmt.Errorf("container init exited before it was ready")
+			}
+			return nil
+		}
+		switch msg.Type {
+		case SyncReady:
+			ready = true
+		case SyncError:
+			return fmt.Errorf("%s", msg.Message)
+		}
+	}
+}
+
+// 打开 init 进程中的同步管道，并设置 close-on-exec
+func openSyncPipe() *os.File {
+	syscall.CloseOnExec(syncPipeFd)
+	return os.NewFile(uintptr(syncPipeFd), "sync")
+}
+
+// init 进程向父进程发送消息
+func writeSyncMessage(syncPipe *os.File, msg SyncMessage) error {
+	return json.NewEncoder(syncPipe).Encode(msg)
+}
@@ -1,8 +1,10 @@
 package container
 
 import (
+	"copyDocker/archive"
 	"fmt"
 	"github.com/sirupsen/logrus"
+	"io/ioutil"
 	"os"
 	"os/exec"
 	"strings"
@@ -15,40 +17,54 @@ import (
 */
 
 // NewWorkSpace 新的工作空间
-func NewWorkSpace(volume, imageName, containerName string) {
-	CreateReadOnlyLayer(imageName)
-	CreateWriteLayer(containerName)
-	CreateMountPoint(containerName, imageName)
+// 已存在的可写层与挂载点会被复用，start 已退出的容器时保留其中的修改
+func NewWorkSpace(volume, imageName, containerID string) error {
+	if err := CreateReadOnlyLayer(imageName); err != nil {
+		return err
+	}
+	if err := CreateWriteLayer(containerID); err != nil {
+		return err
+	}
+	if err := CreateMountPoint(containerID, imageName); err != nil {
+		return err
+	}
 	// 根据 volume 判断是否执行挂载数据卷操作
 	if volume != "" {
 		volumeURLs := volumeUrlExtract(volume)
 		length := len(volumeURLs)
 		if length == 2 && volumeURLs[0] != "" && volumeURLs[1] != "" {
-			MountVolume(volumeURLs, containerName)
+			if err := MountVolume(volumeURLs, containerID); err != nil {
+				return err
+			}
 			logrus.Infof("%q", volumeURLs)
 		} else {
 			logrus.Infof("Volume parameter input is not correct .")
 		}
 	}
+	return nil
 }
 
 // MountVolume 挂载数据卷
 // 1. 读取宿主机文件目录URL，创建宿主机文件目录 /root/${parent}
-// 2. 读取容器挂载点URL，在容器文件系统里创建挂载点 /root/mnt/${containerUrl}
+// 2. 读取容器挂载点URL，在容器文件系统里创建挂载点 ${state}/mnt/${containerUrl}
 // 3. 把宿主机文件目录挂载到容器挂载点，
-func MountVolume(volumeURLs []string, containerName string) {
+// 目录已存在时直接使用
+func MountVolume(volumeURLs []string, containerID string) error {
 	// 创建宿主机文件目录
 	parentUrl := volumeURLs[0]
-	if err := os.Mkdir(parentUrl, 0777); err != nil {
-		logrus.Infof("Mkdir parent dir %s error: %v", parentUrl, err)
+	if err := os.Mkdir(parentUrl, 0777); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("mkdir parent dir %s error %v", parentUrl, err)
 	}
 
 	// 在容器文件系统里创建挂载点
 	containerUrl := volumeURLs[1]
 	// root/mnt/${}/containerUrl
-	containerVolumeURL := fmt.Sprintf(MntURL, containerName) + "/" + containerUrl
-	if err := os.Mkdir(containerVolumeURL, 0777); err != nil {
-		logrus.Infof("Mkdir container dir %s error:%v", containerVolumeURL, err)
+	containerVolumeURL := fmt.Sprintf(MntURL, containerID) + "/" + containerUrl
+	if err := os.Mkdir(containerVolumeURL, 0777); err != nil && !os.IsExist(err) {
+		return fmt.Errorf("mkdir container dir %s error %v", containerVolumeURL, err)
+	}
+	if IsMounted(containerVolumeURL) {
+		return nil
 	}
 
 	// 把宿主机文件目录挂载到容器挂载点
@@ -57,82 +73,154 @@ func MountVolume(volumeURLs []string, containerName string) {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		logrus.Errorf("Mount volume failed. %v", err)
+		return fmt.Errorf("mount volume %s error %v", containerVolumeURL, err)
+	}
+	return nil
+}
+
+// NewAnonymousVolume 只指定容器内目录的数据卷，如 -v /data，在 ${root}/volumes 下创建目录作为宿主机目录
+// 返回补全为 ${hostDir}:${containerDir} 的 volume 参数与创建的目录，其它形式的参数原样返回
+func NewAnonymousVolume(volume string) (string, string, error) {
+	if volume == "" || strings.Contains(volume, ":") {
+		return volume, "", nil
+	}
+	if err := os.MkdirAll(VolumesURL, 0755); err != nil {
+		return "", "", err
+	}
+	hostURL, err := ioutil.TempDir(VolumesURL, "")
+	if err != nil {
+		return "", "", fmt.Errorf("create anonymous volume error %v", err)
 	}
+	return hostURL + ":" + volume, hostURL, nil
 }
 
 // CreateReadOnlyLayer 将 busybox.tar 解压到 busybox 目录下，作为容器的只读层
-func CreateReadOnlyLayer(imageName string) {
-	unTarFolderUrl := RootURL + "/" + imageName + "/"
-	imageUrl := RootURL + "/" + imageName + ".tar"
+// 先解压到临时目录，成功后再重命名，解压失败不会留下不完整的只读层
+func CreateReadOnlyLayer(imageName string) error {
+	unTarFolderUrl := ImageLayerURL(imageName)
+	imageUrl := ImageTarURL(imageName)
 	exist, err := PathExists(unTarFolderUrl)
 	if err != nil {
 		logrus.Infof("Fail to judge whether dir %s exists. %v", unTarFolderUrl, err)
 	}
-	// 如果不存在
-	if !exist {
-		if err := os.Mkdir(unTarFolderUrl, 0622); err != nil {
-			logrus.Errorf("Mkdir dir %s error. %v", unTarFolderUrl, err)
-		}
-		_, err = exec.Command("tar", "-xvf", imageUrl, "-C", unTarFolderUrl).
-			CombinedOutput()
-		if err != nil {
-			logrus.Errorf("unTar dir %s error %v", unTarFolderUrl, err)
-		}
+	if exist {
+		return nil
 	}
 
+	imageFile, err := os.Open(imageUrl)
+	if err != nil {
+		return fmt.Errorf("open image %s error %v", imageUrl, err)
+	}
+	defer imageFile.Close()
+
+	logrus.Infof("Extracting image %s to %s", imageUrl, unTarFolderUrl)
+	err = archive.UntarAtomic(imageFile, unTarFolderUrl, &archive.TarOptions{
+		Progress: func(p archive.Progress) {
+			if p.Files%1000 == 0 {
+				logrus.Infof("Extracted %d files, %d bytes from %s", p.Files, p.Bytes, imageUrl)
+			}
+		},
+	})
+	// 同一镜像的容器同时第一次启动时，其它进程已经解包完成
+	if os.IsExist(err) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("untar image %s error %v", imageUrl, err)
+	}
+	return nil
 }
 
 // CreateWriteLayer 创建可写层 writeLayer
-func CreateWriteLayer(containerName string) {
-	writeURL := fmt.Sprintf(WriteLayerUrl, containerName)
-	if err := os.Mkdir(writeURL, 0777); err != nil {
-		logrus.Errorf("Mkdir %s error: %v", writeURL, err)
+func CreateWriteLayer(containerID string) error {
+	writeURL := fmt.Sprintf(WriteLayerUrl, containerID)
+	if err := os.MkdirAll(writeURL, 0777); err != nil {
+		return fmt.Errorf("mkdir %s error %v", writeURL, err)
 	}
+	return nil
 }
 
 // CreateMountPoint 创建挂载点
-func CreateMountPoint(containerName, imageName string) {
+func CreateMountPoint(containerID, imageName string) error {
 	// 创建 mnt 文件夹作为挂载点
-	mntUrl := fmt.Sprintf(MntURL, containerName)
-	if err := os.Mkdir(mntUrl, 0777); err != nil {
-		logrus.Errorf("Mkdir %s error: %v", mntUrl, err)
-	}
-	// /root/writeLayer/${}
-	tmpWriteLayer := fmt.Sprintf(WriteLayerUrl, containerName)
-	// /root/${}
-	tmpImageLocation := RootURL + "/" + imageName
-	// mount -t aufs -o dirs=/root/writeLayer/${}:/root/${} none ./mnt
+	mntUrl := fmt.Sprintf(MntURL, containerID)
+	if err := os.MkdirAll(mntUrl, 0777); err != nil {
+		return fmt.Errorf("mkdir %s error %v", mntUrl, err)
+	}
+	if IsMounted(mntUrl) {
+		return nil
+	}
+	// ${root}/writeLayer/${}
+	tmpWriteLayer := fmt.Sprintf(WriteLayerUrl, containerID)
+	// ${root}/images/${}
+	tmpImageLocation := ImageLayerURL(imageName)
+	// mount -t aufs -o dirs=${root}/writeLayer/${}:${root}/images/${} none ./mnt
 	dirs := "dirs=" + tmpWriteLayer + ":" + tmpImageLocation
 	cmd := exec.Command("mount", "-t", "aufs", "-o", dirs, "none", mntUrl)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 	if err := cmd.Run(); err != nil {
-		logrus.Errorf("exec mount error:%v", err)
+		return fmt.Errorf("mount %s error %v", mntUrl, err)
+	}
+	return nil
+}
+
+// MountWorkSpace 保证容器的文件系统已经挂载，返回挂载点
+// 已停止的容器在重启机器之后挂载点已经卸载，此时重新挂载 aufs，不挂载数据卷
+func MountWorkSpace(containerID, imageName string) (string, error) {
+	mntURL := fmt.Sprintf(MntURL, containerID)
+	if IsMounted(mntURL) {
+		return mntURL, nil
+	}
+	writeURL := fmt.Sprintf(WriteLayerUrl, containerID)
+	if exist, _ := PathExists(writeURL); !exist {
+		return "", fmt.Errorf("write layer %s does not exist", writeURL)
+	}
+	if imageName == "" {
+		return "", fmt.Errorf("filesystem %s is not mounted and the image is unknown", mntURL)
 	}
+	unlock, err := LockImages(false)
+	if err != nil {
+		return "", err
+	}
+	defer unlock()
+	if err := CreateReadOnlyLayer(imageName); err != nil {
+		return "", err
+	}
+	if err := CreateMountPoint(containerID, imageName); err != nil {
+		return "", err
+	}
+	if !IsMounted(mntURL) {
+		return "", fmt.Errorf("mount filesystem %s failed", mntURL)
+	}
+	return mntURL, nil
 }
 
 // DeleteWorkSpace
 // 1. umount mnt 目录
 // 2. 删除 mnt 目录
 // 3. 在 DeleteWriteLayer 函数中删除 writeLayer 文件夹
-func DeleteWorkSpace(volume, containerName string) {
+// mnt 目录没有完全卸载时不再删除，返回错误，避免误删挂载进来的数据卷
+func DeleteWorkSpace(volume, containerID string) error {
 	if volume != "" {
 		volumeURLs := volumeUrlExtract(volume)
 		length := len(volumeURLs)
 		if length == 2 && volumeURLs[0] != "" && volumeURLs[1] != "" {
-			DeleteVolume(volumeURLs, containerName)
+			DeleteVolume(volumeURLs, containerID)
 		}
 	}
 
-	DeleteMountPoint(containerName)
-	DeleteWriteLayer(containerName)
+	if err := DeleteMountPoint(containerID); err != nil {
+		return err
+	}
+	DeleteWriteLayer(containerID)
+	return nil
 }
 
-func DeleteVolume(volumeURLs []string, containerName string)error{
-	mntUrl:=fmt.Sprintf(MntURL,containerName)
-	containerUrl:=mntUrl+"/"+volumeURLs[1]
-	if _,err:=exec.Command("umount",containerUrl).CombinedOutput();err!=nil{
+func DeleteVolume(volumeURLs []string, containerID string) error {
+	mntUrl := fmt.Sprintf(MntURL, containerID)
+	containerUrl := mntUrl + "/" + volumeURLs[1]
+	if _, err := exec.Command("umount", containerUrl).CombinedOutput(); err != nil {
 		logrus.Errorf("Umount volume %s failed. %v", containerUrl, err)
 		return err
 	}
@@ -140,11 +228,11 @@ func DeleteVolume(volumeURLs []string, containerName string)error{
 }
 
 // DeleteMountPointWithVolume 删除挂载点，且删除对应的数据卷
-// 1. 卸载 volume 挂载点的文件系统（/root/mnt/${container}）
-// 2. 卸载整个容器系统的挂载点（/root/mnt）
+// 1. 卸载 volume 挂载点的文件系统（${state}/mnt/${container}）
+// 2. 卸载整个容器系统的挂载点（${state}/mnt）
 // 3. 删除容器文件系统挂载点
-func DeleteMountPointWithVolume(volumeURLs []string, containerName string) {
-	mntUrl := fmt.Sprintf(MntURL, containerName)
+func DeleteMountPointWithVolume(volumeURLs []string, containerID string) {
+	mntUrl := fmt.Sprintf(MntURL, containerID)
 	// 卸载容器里的挂载点
 	containerUrl := mntUrl + volumeURLs[1]
 	cmd := exec.Command("umount", containerUrl)
@@ -154,7 +242,7 @@ func DeleteMountPointWithVolume(volumeURLs []string, containerName string) {
 		logrus.Errorf("Umount volume failed. %v", err)
 	}
 	// 卸载整个容器文件系统的挂载点
-	// umount /root/mnt
+	// umount ${state}/mnt
 	cmd = exec.Command("umount", mntUrl)
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
@@ -162,27 +250,32 @@ func DeleteMountPointWithVolume(volumeURLs []string, containerName string) {
 		logrus.Errorf("Umount mountpoint failed. %v", err)
 	}
 
-	// 删除容器文件系统挂载点
+	// 删除容器文件系统挂载点，仍有挂载时不删除
+	if err := UnmountAll(mntUrl); err != nil {
+		logrus.Errorf("Umount %s error %v", mntUrl, err)
+		return
+	}
 	if err := os.RemoveAll(mntUrl); err != nil {
 		logrus.Infof("Remove mountpoint dir %s error: %v", mntUrl, err)
 	}
 }
 
 // DeleteMountPoint umount && del
-func DeleteMountPoint(containerName string) {
-	mntUrl := fmt.Sprintf(MntURL, containerName)
-	_, err := exec.Command("umount", mntUrl).CombinedOutput()
-	if err != nil {
-		logrus.Errorf("%v", err)
+// 先由深至浅卸载 mnt 下的数据卷与容器文件系统，卸载失败时不删除目录
+func DeleteMountPoint(containerID string) error {
+	mntUrl := fmt.Sprintf(MntURL, containerID)
+	if err := UnmountAll(mntUrl); err != nil {
+		return fmt.Errorf("umount %s error %v", mntUrl, err)
 	}
 	if err := os.RemoveAll(mntUrl); err != nil {
 		logrus.Errorf("Remove mountpoint dir %s error:%v", mntUrl, err)
 	}
+	return nil
 }
 
 // DeleteWriteLayer 删除读层
-func DeleteWriteLayer(containerName string) {
-	writeURL := fmt.Sprintf(WriteLayerUrl, containerName)
+func DeleteWriteLayer(containerID string) {
+	writeURL := fmt.Sprintf(WriteLayerUrl, containerID)
 	if err := os.RemoveAll(writeURL); err != nil {
 		logrus.Errorf("Remove dir %s error: %v", writeURL, err)
 	}
@@ -0,0 +1,167 @@
+package main
+
+import (
+	"copyDocker/archive"
+	"copyDocker/container"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 14:20 2022/3/23
+ @Description: docker cp 的实现，在宿主机与容器之间拷贝文件
+*/
+
+// 拷贝文件，src 与 dst 中有且只有一个为 container:path 的形式
+// - 表示从标准输入读取、或向标准输出写入 tar 流
+func copyContainer(src, dst string) error {
+	srcContainer, srcPath := splitCopyArg(src)
+	dstContainer, dstPath := splitCopyArg(dst)
+	switch {
+	case srcContainer != "" && dstContainer != "":
+		return fmt.Errorf("copying between containers is not supported")
+	case srcContainer != "":
+		return copyFromContainer(srcContainer, srcPath, dstPath)
+	case dstContainer != "":
+		return copyToContainer(srcPath, dstContainer, dstPath)
+	default:
+		return fmt.Errorf("must specify at least one container source")
+	}
+}
+
+// 解析 container:path 形式的参数，本地路径返回空的容器名
+func splitCopyArg(arg string) (string, string) {
+	if arg == "-" || filepath.IsAbs(arg) || strings.HasPrefix(arg, ".") {
+		return "", arg
+	}
+	i := strings.Index(arg, ":")
+	if i <= 0 {
+		return "", arg
+	}
+	return arg[:i], arg[i+1:]
+}
+
+// 容器的根目录
+// init 进程存活时（包括暂停中的容器）通过 /proc/${pid}/root 进入其 mount namespace，这样数据卷与 tmpfs 等挂载也能看到
+// 否则使用宿主机上的挂载点 ${state}/mnt/${}，未挂载时重新挂载
+func containerRootfs(info *container.ContainerInfo) (string, error) {
+	if info.IsAlive() {
+		root := fmt.Sprintf("/proc/%s/root", info.Pid)
+		if _, err := os.Stat(root); err == nil {
+			return root, nil
+		}
+	}
+	return container.MountWorkSpace(info.ID, info.Image)
+}
+
+// 归档中源路径的名字，拷贝根目录时为 .，即只拷贝其中的内容
+// 源路径可能经过符号链接解析，使用解析后的名字
+func copyName(srcPath, src string) string {
+	if path.Clean("/"+filepath.ToSlash(srcPath)) == "/" {
+		return "."
+	}
+	return filepath.Base(src)
+}
+
+// 从容器中拷贝到宿主机
+func copyFromContainer(containerName, srcPath, dstPath string) error {
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	rootfs, err := containerRootfs(info)
+	if err != nil {
+		return err
+	}
+	src, err := archive.ResolvePath(rootfs, srcPath)
+	if err != nil {
+		return err
+	}
+	srcInfo, err := os.Lstat(src)
+	if err != nil {
+		return fmt.Errorf("no such file or directory in container %s: %s", containerName, srcPath)
+	}
+
+	name := copyName(srcPath, src)
+	if dstPath == "-" {
+		return archive.Tar(src, name, os.Stdout, nil)
+	}
+	destDir, destName, err := copyTarget(dstPath, name, srcInfo)
+	if err != nil {
+		return err
+	}
+	return copyPath(src, destDir, destName)
+}
+
+// 从宿主机拷贝到容器中
+func copyToContainer(srcPath, containerName, dstPath string) error {
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	rootfs, err := containerRootfs(info)
+	if err != nil {
+		return err
+	}
+	dst, err := archive.ResolvePath(rootfs, dstPath)
+	if err != nil {
+		return err
+	}
+
+	// 标准输入为 tar 流，目标必须是已存在的目录
+	if srcPath == "-" {
+		if fi, err := os.Stat(dst); err != nil || !fi.IsDir() {
+			return fmt.Errorf("destination %s must be a directory", dstPath)
+		}
+		return archive.Untar(os.Stdin, dst, nil)
+	}
+	srcInfo, err := os.Lstat(srcPath)
+	if err != nil {
+		return err
+	}
+	destDir, destName, err := copyTarget(dst, copyName(srcPath, srcPath), srcInfo)
+	if err != nil {
+		return err
+	}
+	return copyPath(srcPath, destDir, destName)
+}
+
+// 根据目标路径计算解包的目录与根名
+// 目标为已存在的目录时，以 name 拷贝到目录之下；否则以目标路径的名字创建或覆盖
+func copyTarget(dst, name string, srcInfo os.FileInfo) (string, string, error) {
+	fi, err := os.Stat(dst)
+	if err == nil && fi.IsDir() {
+		return dst, name, nil
+	}
+	if err != nil && !os.IsNotExist(err) {
+		return "", "", err
+	}
+	if err == nil && srcInfo.IsDir() {
+		return "", "", fmt.Errorf("cannot copy a directory to a file: %s", dst)
+	}
+	if os.IsNotExist(err) && strings.HasSuffix(dst, "/") {
+		return "", "", fmt.Errorf("destination directory %s does not exist", dst)
+	}
+
+	parent := filepath.Dir(dst)
+	if pi, err := os.Stat(parent); err != nil || !pi.IsDir() {
+		return "", "", fmt.Errorf("destination directory %s does not exist", parent)
+	}
+	return parent, filepath.Base(dst), nil
+}
+
+// 通过管道以 tar 流的形式拷贝，保留属主与权限
+func copyPath(src, destDir, destName string) error {
+	reader, writer := io.Pipe()
+	go func() {
+		writer.CloseWithError(archive.Tar(src, destName, writer, nil))
+	}()
+	err := archive.Untar(reader, destDir, nil)
+	reader.Close()
+	return err
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"copyDocker/container"
+	"copyDocker/internal/testutil"
+	"copyDocker/state"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+func TestSplitCopyArg(t *testing.T) {
+	tests := []struct {
+		arg           string
+		containerName string
+		path          string
+	}{
+		{arg: "web:/etc/hosts", containerName: "web", path: "/etc/hosts"},
+		{arg: "web:", containerName: "web", path: ""},
+		{arg: "/tmp/a:b", path: "/tmp/a:b"},
+		{arg: "./a:b", path: "./a:b"},
+		{arg: ":/etc", path: ":/etc"},
+		{arg: "file", path: "file"},
+		{arg: "-", path: "-"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.arg, func(t *testing.T) {
+			containerName, p := splitCopyArg(tt.arg)
+			if containerName != tt.containerName || p != tt.path {
+				t.Errorf("splitCopyArg(%q) = %q, %q, want %q, %q", tt.arg, containerName, p, tt.containerName, tt.path)
+			}
+		})
+	}
+}
+
+func TestCopyName(t *testing.T) {
+	tests := []struct {
+		srcPath string
+		src     string
+		want    string
+	}{
+		{srcPath: "/", src: "/proc/1/root", want: "."},
+		{srcPath: "", src: "/proc/1/root", want: "."},
+		{srcPath: "/..", src: "/proc/1/root", want: "."},
+		{srcPath: "/etc/", src: "/proc/1/root/etc", want: "etc"},
+		{srcPath: "/link", src: "/proc/1/root/target", want: "target"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.srcPath, func(t *testing.T) {
+			if got := copyName(tt.srcPath, tt.src); got != tt.want {
+				t.Errorf("copyName(%q, %q) = %q, want %q", tt.srcPath, tt.src, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCopyTarget(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copyDocker-cp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Mkdir(filepath.Join(dir, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	fileInfo, _ := os.Stat(filepath.Join(dir, "file"))
+	dirInfo, _ := os.Stat(filepath.Join(dir, "dir"))
+
+	tests := []struct {
+		name     string
+		dst      string
+		srcInfo  os.FileInfo
+		destDir  string
+		destName string
+		wantErr  bool
+	}{
+		{name: "into existing dir", dst: "dir", srcInfo: fileInfo, destDir: "dir", destName: "src"},
+		{name: "overwrite file", dst: "file", srcInfo: fileInfo, destDir: ".", destName: "file"},
+		{name: "new file", dst: "dir/new", srcInfo: fileInfo, destDir: "dir", destName: "new"},
+		{name: "new dir", dst: "new", srcInfo: dirInfo, destDir: ".", destName: "new"},
+		{name: "dir onto file", dst: "file", srcInfo: dirInfo, wantErr: true},
+		{name: "missing dir with slash", dst: "missing/", srcInfo: fileInfo, wantErr: true},
+		{name: "missing parent", dst: "missing/new", srcInfo: fileInfo, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst := filepath.Join(dir, tt.dst)
+			if tt.dst[len(tt.dst)-1] == '/' {
+				dst += "/"
+			}
+			destDir, destName, err := copyTarget(dst, "src", tt.srcInfo)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("copyTarget(%q) want error", tt.dst)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("copyTarget(%q) error %v", tt.dst, err)
+			}
+			if destDir != filepath.Join(dir, tt.destDir) || destName != tt.destName {
+				t.Errorf("copyTarget(%q) = %q, %q, want %q, %q", tt.dst, destDir, destName, tt.destDir, tt.destName)
+			}
+		})
+	}
+}
+
+// 以测试进程作为容器的 init 进程，容器的根目录即宿主机的根目录
+func saveTestContainer(t *testing.T, status string) *container.ContainerInfo {
+	pid := strconv.Itoa(os.Getpid())
+	startTime, err := container.ProcessStartTime(pid)
+	if err != nil {
+		t.Fatal(err)
+	}
+	info := &container.ContainerInfo{
+		ID:           "0123456789",
+		Name:         "cp-test",
+		Pid:          pid,
+		PidStartTime: startTime,
+		Status:       status,
+	}
+	if err := state.Create(info.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Save(info); err != nil {
+		t.Fatal(err)
+	}
+	return info
+}
+
+func TestContainerRootfs(t *testing.T) {
+	for _, status := range []string{container.RUNNING, container.PAUSED} {
+		t.Run(status, func(t *testing.T) {
+			testutil.SetupRoot(t)
+			info := saveTestContainer(t, status)
+			rootfs, err := containerRootfs(info)
+			if err != nil {
+				t.Fatalf("containerRootfs error %v", err)
+			}
+			if want := fmt.Sprintf("/proc/%d/root", os.Getpid()); rootfs != want {
+				t.Errorf("containerRootfs() = %s, want %s", rootfs, want)
+			}
+		})
+	}
+}
+
+func TestCopyContainer(t *testing.T) {
+	root := testutil.SetupRoot(t)
+	saveTestContainer(t, container.PAUSED)
+	src := filepath.Join(root, "src")
+	if err := os.MkdirAll(filepath.Join(src, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "sub", "file"), []byte("content"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	host := filepath.Join(root, "host")
+	if err := os.Mkdir(host, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name string
+		src  string
+		dst  string
+		want string
+	}{
+		{name: "from container into dir", src: "cp-test:" + src, dst: host, want: filepath.Join(host, "src", "sub", "file")},
+		{name: "from container to new name", src: "cp-test:" + src + "/sub/file", dst: filepath.Join(host, "renamed"), want: filepath.Join(host, "renamed")},
+		{name: "to container", src: filepath.Join(src, "sub"), dst: "0123456789:" + filepath.Join(root, "host"), want: filepath.Join(host, "sub", "file")},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := copyContainer(tt.src, tt.dst); err != nil {
+				t.Fatalf("copyContainer(%q, %q) error %v", tt.src, tt.dst, err)
+			}
+			content, err := ioutil.ReadFile(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(content) != "content" {
+				t.Errorf("content of %s = %q, want %q", tt.want, content, "content")
+			}
+			fi, err := os.Stat(tt.want)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fi.Mode().Perm() != 0600 {
+				t.Errorf("mode of %s = %v, want %v", tt.want, fi.Mode().Perm(), os.FileMode(0600))
+			}
+		})
+	}
+
+	if err := copyContainer("cp-test:"+filepath.Join(root, "missing"), host); err == nil {
+		t.Errorf("copy missing path want error")
+	}
+	if err := copyContainer("cp-test:/a", "cp-test:/b"); err == nil {
+		t.Errorf("copy between containers want error")
+	}
+}
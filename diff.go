@@ -0,0 +1,44 @@
+package main
+
+import (
+	"copyDocker/container"
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 15:40 2022/3/22
+ @Description: docker diff 的实现
+*/
+
+// 列出容器相对镜像的文件系统变更
+// A 新增，C 修改，D 删除
+func diffContainer(containerName string, jsonOutput bool) error {
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	changes, err := container.ContainerChanges(info.ID, info.Image)
+	if err != nil {
+		return err
+	}
+
+	// 供工具使用的 json 格式
+	if jsonOutput {
+		if changes == nil {
+			changes = []container.Change{}
+		}
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(changes); err != nil {
+			return fmt.Errorf("json encode changes error %v", err)
+		}
+		return nil
+	}
+	for _, change := range changes {
+		fmt.Fprintf(os.Stdout, "%s %s\n", change.Kind, change.Path)
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"copyDocker/container"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 10:50 2022/3/27
+ @Description: 容器的环境变量，不继承宿主机的环境变量
+*/
+
+// 容器的环境变量：默认的 PATH，之后依次为镜像与 -e 设置的变量，同名的变量后者覆盖前者
+func containerEnv(image string, envs []string) []string {
+	config, err := container.LoadImageConfig(image)
+	if err != nil {
+		logrus.Warnf("Load config of image %s error %v", image, err)
+		config = &container.ImageConfig{}
+	}
+	return mergeEnv([]string{container.DefaultPathEnv}, config.Env, expandEnv(envs))
+}
+
+// -e 只给出变量名时使用宿主机上的同名变量，宿主机上没有时忽略
+func expandEnv(envs []string) []string {
+	var result []string
+	for _, env := range envs {
+		if strings.Contains(env, "=") {
+			result = append(result, env)
+			continue
+		}
+		if value, ok := os.LookupEnv(env); ok {
+			result = append(result, env+"="+value)
+		}
+	}
+	return result
+}
+
+// 合并环境变量，保持首次出现的顺序，同名的变量后面的覆盖前面的
+func mergeEnv(envs ...[]string) []string {
+	var result []string
+	index := map[string]int{}
+	for _, list := range envs {
+		for _, env := range list {
+			key := strings.SplitN(env, "=", 2)[0]
+			if i, ok := index[key]; ok {
+				result[i] = env
+				continue
+			}
+			index[key] = len(result)
+			result = append(result, env)
+		}
+	}
+	return result
+}
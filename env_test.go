@@ -0,0 +1,96 @@
+package main
+
+import (
+	"copyDocker/container"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestMergeEnv(t *testing.T) {
+	tests := []struct {
+		name string
+		envs [][]string
+		want []string
+	}{
+		{name: "none"},
+		{
+			name: "keep order",
+			envs: [][]string{{"PATH=/bin", "HOME=/root"}, {"LANG=C"}},
+			want: []string{"PATH=/bin", "HOME=/root", "LANG=C"},
+		},
+		{
+			name: "later overrides in place",
+			envs: [][]string{{"PATH=/bin", "HOME=/root"}, {"PATH=/usr/bin"}},
+			want: []string{"PATH=/usr/bin", "HOME=/root"},
+		},
+		{
+			name: "duplicate in one list",
+			envs: [][]string{{"A=1", "B=2", "A=3"}},
+			want: []string{"A=3", "B=2"},
+		},
+		{
+			name: "empty value",
+			envs: [][]string{{"A=1"}, {"A="}},
+			want: []string{"A="},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeEnv(tt.envs...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeEnv(%q) = %q, want %q", tt.envs, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpandEnv(t *testing.T) {
+	os.Setenv("COPYDOCKER_TEST_HOST", "host value")
+	defer os.Unsetenv("COPYDOCKER_TEST_HOST")
+	os.Unsetenv("COPYDOCKER_TEST_MISSING")
+
+	tests := []struct {
+		name string
+		envs []string
+		want []string
+	}{
+		{name: "none"},
+		{name: "key and value", envs: []string{"A=1", "B="}, want: []string{"A=1", "B="}},
+		{name: "from host", envs: []string{"COPYDOCKER_TEST_HOST"}, want: []string{"COPYDOCKER_TEST_HOST=host value"}},
+		{name: "missing on host", envs: []string{"COPYDOCKER_TEST_MISSING", "A=1"}, want: []string{"A=1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := expandEnv(tt.envs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("expandEnv(%q) = %q, want %q", tt.envs, got, tt.want)
+			}
+		})
+	}
+}
+
+// 没有元数据的镜像只使用默认的 PATH 与 -e
+func TestContainerEnv(t *testing.T) {
+	os.Setenv("COPYDOCKER_TEST_HOST", "host value")
+	defer os.Unsetenv("COPYDOCKER_TEST_HOST")
+
+	tests := []struct {
+		name string
+		envs []string
+		want []string
+	}{
+		{name: "default path only", want: []string{container.DefaultPathEnv}},
+		{name: "override path", envs: []string{"PATH=/bin"}, want: []string{"PATH=/bin"}},
+		{
+			name: "host variable only when asked",
+			envs: []string{"A=1", "COPYDOCKER_TEST_HOST"},
+			want: []string{container.DefaultPathEnv, "A=1", "COPYDOCKER_TEST_HOST=host value"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containerEnv("copydocker-test-no-such-image", tt.envs); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("containerEnv(%q) = %q, want %q", tt.envs, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"copyDocker/container"
-	"encoding/json"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"io/ioutil"
@@ -20,16 +19,21 @@ import (
 const ENV_EXEC_PID = "copyDocker_pid"
 const ENV_EXEC_CMD = "copyDocker_cmd"
 
-func ExecContainer(containerName string, commandArray []string) {
-
-	pid, err := getContainerPidByName(containerName)
+func ExecContainer(containerName string, commandArray []string) error {
+	info, err := lookupContainer(containerName)
 	if err != nil {
-		logrus.Errorf("Exec container getContainerPidByName %s error %v",
-			containerName, err)
-		return
+		return err
+	}
+	if info.Status == container.PAUSED {
+		return fmt.Errorf("container %s is paused, unpause the container before exec", containerName)
 	}
+	if !info.IsAlive() {
+		return fmt.Errorf("container %s is not running", containerName)
+	}
+	pid := info.Pid
 
-	cmdStr := strings.Join(commandArray, "")
+	// nsenter 中通过 system() 交给 sh 执行，参数需要转义
+	cmdStr := shellJoin(commandArray)
 	logrus.Infof("container pid %s", pid)
 	logrus.Infof("command %s", cmdStr)
 
@@ -39,32 +43,17 @@ func ExecContainer(containerName string, commandArray []string) {
 	cmd.Stdout = os.Stdout
 	cmd.Stderr = os.Stderr
 
-	os.Setenv(ENV_EXEC_PID, pid)
-	os.Setenv(ENV_EXEC_CMD, cmdStr)
-	// 获取对应的变量
-	containerEnvs := getEnvsByPid(pid)
-	cmd.Env = append(os.Environ(), containerEnvs...)
-
-	if err := cmd.Run(); err != nil {
-		logrus.Errorf("Exec container %s error: %v", containerName, err)
+	// 使用容器的环境变量，不继承宿主机的环境变量
+	// --init 时 1 号进程是 init 自己，之前版本的容器没有记录配置，才从 1 号进程读取
+	var containerEnvs []string
+	if info.Config != nil {
+		containerEnvs = info.Config.Env
+	} else {
+		containerEnvs = getEnvsByPid(pid)
 	}
-}
+	cmd.Env = append(containerEnvs, ENV_EXEC_PID+"="+pid, ENV_EXEC_CMD+"="+cmdStr)
 
-func getContainerPidByName(containerName string) (string, error) {
-	// 老规矩，先拼接容器存储的路径
-	// /var/run/copyDocker/${}/
-	dirURL := fmt.Sprintf(container.DefaultInfoLocation, containerName)
-	configFilePath := dirURL + container.ConfigName
-	// 读取config
-	contentBytes, err := ioutil.ReadFile(configFilePath)
-	if err != nil {
-		return "", err
-	}
-	var containerInfo container.ContainerInfo
-	if err := json.Unmarshal(contentBytes, &containerInfo); err != nil {
-		return "", err
-	}
-	return containerInfo.Pid, err
+	return cmd.Run()
 }
 
 // 根据 Pid 来获取 Envs
@@ -80,3 +69,23 @@ func getEnvsByPid(pid string) []string {
 	envs := strings.Split(string(contentBytes), "\u0000")
 	return envs
 }
+
+// 将参数逐个转义后以空格拼接，保证 sh 解析后得到原来的参数
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = shellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// 用单引号转义，参数中的单引号先结束引用，转义后再重新开始引用
+func shellQuote(s string) string {
+	if s == "" {
+		return "''"
+	}
+	if strings.Trim(s, "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789@%+=:,./_-") == "" {
+		return s
+	}
+	return "'" + strings.Replace(s, "'", `'\''`, -1) + "'"
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"os/exec"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestShellJoin(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		want string
+	}{
+		{name: "plain", args: []string{"ls", "-l", "/tmp"}, want: "ls -l /tmp"},
+		{name: "empty argument", args: []string{"echo", ""}, want: "echo ''"},
+		{name: "space", args: []string{"sh", "-c", "echo a b"}, want: "sh -c 'echo a b'"},
+		{name: "single quote", args: []string{"echo", "it's"}, want: `echo 'it'\''s'`},
+		{name: "special characters", args: []string{"echo", "$HOME", "a;b", "*"}, want: `echo '$HOME' 'a;b' '*'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := shellJoin(tt.args)
+			if got != tt.want {
+				t.Fatalf("shellJoin(%q) = %s, want %s", tt.args, got, tt.want)
+			}
+			// sh 解析后得到原来的参数
+			parsed, err := exec.Command("sh", "-c", `set -- `+got+`; for arg in "$@"; do printf '%s\0' "$arg"; done`).Output()
+			if err != nil {
+				t.Fatalf("sh error %v", err)
+			}
+			if args := strings.Split(strings.TrimSuffix(string(parsed), "\x00"), "\x00"); !reflect.DeepEqual(args, tt.args) {
+				t.Errorf("sh parsed %s as %q, want %q", got, args, tt.args)
+			}
+		})
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"archive/tar"
+	"copyDocker/archive"
+	"copyDocker/container"
+	"copyDocker/state"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 10:05 2022/3/24
+ @Description: docker export 与 docker import 的实现，导出、导入扁平的容器文件系统
+*/
+
+// 将容器合并后的文件系统 ${state}/mnt/${} 打包成 tar 流
+// output 为空或 - 时输出至标准输出
+func exportContainer(containerName, output string) error {
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	// 挂载点未挂载时只是一个空目录，导出的 tar 包也是空的
+	mntURL, err := container.MountWorkSpace(info.ID, info.Image)
+	if err != nil {
+		return fmt.Errorf("container %s rootfs error %v", containerName, err)
+	}
+
+	// 数据卷属于其它挂载点，不会被导出
+	opts := &archive.TarOptions{OneFileSystem: true}
+	if output == "" || output == "-" {
+		return archive.Tar(mntURL, ".", os.Stdout, opts)
+	}
+	file, err := os.Create(output)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return archive.Tar(mntURL, ".", file, opts)
+}
+
+// 将 tar 包导入为单层镜像 ${root}/images/${image}.tar
+// src 为 - 时从标准输入读取
+func importImage(src, imageName string, labels map[string]string) error {
+	if err := container.ValidateImageName(imageName); err != nil {
+		return err
+	}
+	var reader io.Reader = os.Stdin
+	if src != "-" {
+		file, err := os.Open(src)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		reader = file
+	}
+
+	// 已被容器使用的镜像，其只读层正挂载着，不能覆盖
+	containers, err := state.List()
+	if err != nil {
+		return err
+	}
+	for _, info := range containers {
+		if info.Image != "" && container.ImageStoreName(info.Image) == container.ImageStoreName(imageName) {
+			return fmt.Errorf("image %s is used by container %s", imageName, info.Name)
+		}
+	}
+
+	// prune 会清理残留的临时文件，导入期间持有镜像的共享锁
+	unlock, err := container.LockImages(false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// 先写入临时文件，校验通过后再重命名，避免留下不完整的镜像
+	tmpFile, err := ioutil.TempFile(container.ImageStoreURL, ".import-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	_, err = io.Copy(tmpFile, reader)
+	tmpFile.Close()
+	if err != nil {
+		return err
+	}
+	if err := checkTarFile(tmpFile.Name()); err != nil {
+		return fmt.Errorf("invalid tar archive %s: %v", src, err)
+	}
+
+	imageURL := container.ImageTarURL(imageName)
+	if err := os.Rename(tmpFile.Name(), imageURL); err != nil {
+		return err
+	}
+	// 删除之前解压的只读层，下次 run 时重新解压
+	if err := os.RemoveAll(container.ImageLayerURL(imageName)); err != nil {
+		return err
+	}
+	// 覆盖之前镜像的元数据
+	if err := container.SaveImageConfig(imageName, &container.ImageConfig{Labels: labels}); err != nil {
+		return err
+	}
+	logrus.Infof("Import image %s to %s", imageName, imageURL)
+	return nil
+}
+
+// 校验文件是否为 tar 包，支持 gzip 与 zstd 压缩
+func checkTarFile(fileName string) error {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	reader, err := archive.DecompressStream(file)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+
+	tr := tar.NewReader(reader)
+	for {
+		_, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"copyDocker/container"
+	"copyDocker/internal/testutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// 非法的镜像名在删除旧的只读层之前被拒绝，不会删除镜像目录之外的内容
+func TestImportImageInvalidName(t *testing.T) {
+	root := testutil.SetupRoot(t)
+	if err := os.MkdirAll(container.ImageStoreURL, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"..", "", ".", "../images", "a/b"} {
+		t.Run(name, func(t *testing.T) {
+			if err := importImage(os.DevNull, name, nil); err == nil {
+				t.Errorf("importImage(%q) want error", name)
+			}
+			for _, dir := range []string{root, filepath.Join(root, "lib"), container.ImageStoreURL} {
+				if _, err := os.Stat(dir); err != nil {
+					t.Fatalf("importImage(%q) removed %s: %v", name, dir, err)
+				}
+			}
+		})
+	}
+}
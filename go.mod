@@ -3,10 +3,12 @@ module copyDocker
 go 1.15
 
 require (
+	github.com/klauspost/compress v1.11.13
 	github.com/sirupsen/logrus v1.8.1
 	github.com/stretchr/testify v1.4.0 // indirect
 	github.com/urfave/cli v1.22.5
 	github.com/vishvananda/netlink v1.1.0
-	golang.org/x/sys v0.0.0-20200116001909-b77594299b42 // indirect
+	github.com/vishvananda/netns v0.0.0-20191106174202-0a2b9b5464df
+	golang.org/x/sys v0.0.0-20200116001909-b77594299b42
 	gopkg.in/yaml.v2 v2.2.8 // indirect
 )
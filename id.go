@@ -0,0 +1,93 @@
+package main
+
+import (
+	"copyDocker/container"
+	"copyDocker/state"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strings"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 16:30 2022/3/30
+ @Description: 容器 ID 的生成
+*/
+
+const (
+	containerIDLength = 64 // 容器 ID 为 32 字节随机数的十六进制
+	shortIDLength     = 12 // ps 等输出中显示的短 ID
+	legacyIDLength    = 10 // 之前版本的容器 ID 为 10 位数字
+	newIDRetries      = 10 // 生成的 ID 冲突时最多重试的次数
+)
+
+// 生成新的容器 ID，并创建以 ID 命名的容器信息目录
+// 与已有容器的短 ID 相同时重新生成，保证短 ID 可以唯一确定容器；创建目录失败说明 ID 已存在，同样重新生成
+func newContainerID() (string, error) {
+	containers, err := state.List()
+	if err != nil {
+		return "", err
+	}
+	for i := 0; i < newIDRetries; i++ {
+		id, err := randomID()
+		if err != nil {
+			return "", err
+		}
+		if shortIDInUse(containers, id) {
+			continue
+		}
+		if err := state.Create(id); err != nil {
+			if os.IsExist(err) {
+				continue
+			}
+			return "", err
+		}
+		return id, nil
+	}
+	return "", fmt.Errorf("generate container ID error: too many collisions")
+}
+
+// 32 字节的随机数，以十六进制表示
+func randomID() (string, error) {
+	b := make([]byte, containerIDLength/2)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("read random error %v", err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+func shortIDInUse(containers []*container.ContainerInfo, id string) bool {
+	for _, info := range containers {
+		if strings.HasPrefix(info.ID, shortID(id)) {
+			return true
+		}
+	}
+	return false
+}
+
+// 容器的短 ID
+func shortID(id string) string {
+	if len(id) > shortIDLength {
+		return id[:shortIDLength]
+	}
+	return id
+}
+
+// 判断是否为容器 ID，兼容之前版本的 10 位数字 ID
+func isContainerID(s string) bool {
+	switch len(s) {
+	case containerIDLength:
+		_, err := hex.DecodeString(s)
+		return err == nil && strings.ToLower(s) == s
+	case legacyIDLength:
+		for _, c := range s {
+			if c < '0' || c > '9' {
+				return false
+			}
+		}
+		return true
+	}
+	return false
+}
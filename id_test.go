@@ -0,0 +1,105 @@
+package main
+
+import (
+	"copyDocker/container"
+	"copyDocker/internal/testutil"
+	"copyDocker/state"
+	"strings"
+	"testing"
+)
+
+func TestIsContainerID(t *testing.T) {
+	id := strings.Repeat("0123456789abcdef", 4)
+	tests := []struct {
+		name string
+		s    string
+		want bool
+	}{
+		{name: "full ID", s: id, want: true},
+		{name: "legacy ID", s: "1648370000", want: true},
+		{name: "upper case", s: strings.ToUpper(id)},
+		{name: "not hex", s: strings.Repeat("g", 64)},
+		{name: "short ID", s: id[:shortIDLength]},
+		{name: "legacy not digits", s: "16483700ab"},
+		{name: "name", s: "web"},
+		{name: "empty", s: ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isContainerID(tt.s); got != tt.want {
+				t.Errorf("isContainerID(%q) = %v, want %v", tt.s, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRandomID(t *testing.T) {
+	seen := map[string]bool{}
+	for i := 0; i < 100; i++ {
+		id, err := randomID()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !isContainerID(id) || len(id) != containerIDLength {
+			t.Fatalf("randomID() = %q, want %d hex characters", id, containerIDLength)
+		}
+		if seen[id] {
+			t.Fatalf("randomID() returned %s twice", id)
+		}
+		seen[id] = true
+	}
+}
+
+func TestShortIDInUse(t *testing.T) {
+	containers := []*container.ContainerInfo{
+		{ID: "abcdef0123456789"},
+		{ID: "1648370000"},
+	}
+	tests := []struct {
+		id   string
+		want bool
+	}{
+		{id: "abcdef012345ffff", want: true},
+		{id: "abcdef01234fffff"},
+		{id: "1648370000aaaaaa"},
+		{id: "ffffffffffffffff"},
+	}
+	for _, tt := range tests {
+		if got := shortIDInUse(containers, tt.id); got != tt.want {
+			t.Errorf("shortIDInUse(%s) = %v, want %v", tt.id, got, tt.want)
+		}
+	}
+}
+
+func TestNewContainerID(t *testing.T) {
+	testutil.SetupRoot(t)
+	seen := map[string]bool{}
+	for i := 0; i < 10; i++ {
+		id, err := newContainerID()
+		if err != nil {
+			t.Fatalf("newContainerID error %v", err)
+		}
+		if !isContainerID(id) || len(id) != containerIDLength {
+			t.Fatalf("newContainerID() = %q, want %d hex characters", id, containerIDLength)
+		}
+		// 创建了以 ID 命名的容器信息目录
+		if !state.Exists(id) {
+			t.Errorf("directory of container %s not created", id)
+		}
+		if seen[shortID(id)] {
+			t.Fatalf("newContainerID() returned short ID %s twice", shortID(id))
+		}
+		seen[shortID(id)] = true
+		// 写入容器信息，之后生成的 ID 与已有容器的短 ID 比较
+		if err := state.Save(&container.ContainerInfo{ID: id, Name: id, Status: container.Exit}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ids, err := state.IDs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ids) != len(seen) {
+		t.Errorf("IDs() = %d containers, want %d", len(ids), len(seen))
+	}
+}
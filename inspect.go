@@ -0,0 +1,478 @@
+package main
+
+import (
+	"bytes"
+	"copyDocker/container"
+	"copyDocker/network"
+	"copyDocker/state"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 16:40 2022/3/29
+ @Description: docker inspect 的实现，输出容器、镜像、网络、数据卷的详细信息
+*/
+
+// inspect 支持的对象类型，未指定 --type 时按此顺序查找
+var inspectTypes = []string{"container", "image", "network", "volume"}
+
+// 容器的 inspect 输出，字段名与 docker inspect 一致，可以在 --format 中使用，如 {{.State.Pid}}
+type containerInspect struct {
+	Id              string
+	Name            string
+	Created         string
+	Path            string
+	Args            []string
+	State           containerState
+	Image           string
+	RestartCount    int
+	LogPath         string
+	HostConfig      hostConfig
+	Config          containerConfig
+	GraphDriver     graphDriver
+	Mounts          []mountPoint
+	NetworkSettings networkSettings
+}
+
+type containerState struct {
+	Status     string
+	Running    bool
+	Paused     bool
+	Restarting bool
+	OOMKilled  bool
+	Pid        int
+	ExitCode   int
+	StartedAt  time.Time
+	FinishedAt time.Time
+}
+
+type hostConfig struct {
+	Memory        string
+	CpuShares     string
+	CpusetCpus    string
+	PidsLimit     string
+	RestartPolicy restartPolicy
+	AutoRemove    bool
+	Binds         []string
+	LogConfig     logConfig
+	PortBindings  map[string][]portBinding
+}
+
+type restartPolicy struct {
+	Name              string
+	MaximumRetryCount int
+}
+
+type logConfig struct {
+	MaxSize  int64
+	MaxFiles int
+}
+
+type containerConfig struct {
+	Hostname   string
+	User       string
+	Env        []string
+	Cmd        []string
+	Image      string
+	WorkingDir string
+	Tty        bool
+	Init       bool
+	StopSignal string
+	Labels     map[string]string
+}
+
+// 容器的网络配置，Ports 的键为容器端口，如 80/tcp
+type networkSettings struct {
+	IPAddress string
+	Ports     map[string][]portBinding
+	Networks  map[string]endpointSettings
+}
+
+type portBinding struct {
+	HostIp   string
+	HostPort string
+}
+
+type endpointSettings struct {
+	EndpointID string
+	IPAddress  string
+	Device     string
+}
+
+type graphDriver struct {
+	Name string
+	Data map[string]string
+}
+
+type mountPoint struct {
+	Type        string
+	Source      string
+	Destination string
+}
+
+// 镜像的 inspect 输出
+type imageInspect struct {
+	Id       string
+	RepoTags []string
+	Created  time.Time
+	Size     int64
+	Archive  string
+	RootFS   string
+	Config   imageConfig
+}
+
+type imageConfig struct {
+	Labels map[string]string
+}
+
+// 网络的 inspect 输出
+type networkInspect struct {
+	Name    string
+	Driver  string
+	Subnet  string
+	Gateway string
+}
+
+// 数据卷的 inspect 输出，数据卷即 -v 挂载的宿主机目录
+type volumeInspect struct {
+	Name       string
+	Driver     string
+	Mountpoint string
+	UsedBy     []string
+}
+
+// 查找并输出对象的详细信息，没有 format 时输出 json 数组
+// 与 docker 一致，部分对象找不到时仍然输出找到的对象，找不到的对象逐个报错，最后返回错误
+func inspectObjects(names []string, objectType, format string, out io.Writer) error {
+	var tmpl *template.Template
+	if format != "" {
+		var err error
+		if tmpl, err = parseFormat(format); err != nil {
+			return err
+		}
+	}
+	objects := []interface{}{}
+	failed := 0
+	for _, name := range names {
+		obj, err := inspectObject(name, objectType)
+		if err != nil {
+			logrus.Errorf("Inspect %s error %v", name, err)
+			failed++
+			continue
+		}
+		objects = append(objects, obj)
+	}
+	if tmpl == nil {
+		data, err := json.MarshalIndent(objects, "", "    ")
+		if err != nil {
+			return err
+		}
+		if _, err := fmt.Fprintln(out, string(data)); err != nil {
+			return err
+		}
+	} else {
+		for _, obj := range objects {
+			if err := executeFormat(tmpl, obj, out); err != nil {
+				return err
+			}
+		}
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d objects can not be inspected", failed, len(names))
+	}
+	return nil
+}
+
+// 按照类型查找对象
+func inspectObject(name, objectType string) (interface{}, error) {
+	types := inspectTypes
+	if objectType != "" {
+		types = []string{objectType}
+	}
+	for _, t := range types {
+		var obj interface{}
+		var err error
+		switch t {
+		case "container":
+			obj, err = inspectContainer(name)
+		case "image":
+			obj, err = inspectImage(name)
+		case "network":
+			obj, err = inspectNetwork(name)
+		case "volume":
+			obj, err = inspectVolume(name)
+		default:
+			return nil, fmt.Errorf("unknown type %s", t)
+		}
+		if err != nil {
+			return nil, err
+		}
+		if obj != nil {
+			return obj, nil
+		}
+	}
+	return nil, fmt.Errorf("no such object: %s", name)
+}
+
+// 容器不存在时返回 nil
+func inspectContainer(name string) (interface{}, error) {
+	info, err := lookupContainer(name)
+	if err != nil {
+		if _, ok := err.(*noSuchContainerError); ok {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	pid, _ := strconv.Atoi(info.Pid)
+	result := &containerInspect{
+		Id:      info.ID,
+		Name:    info.Name,
+		Created: info.CreatedTime,
+		Image:   info.Image,
+		State: containerState{
+			Status:     info.Status,
+			Running:    info.Status == container.RUNNING || info.Status == container.PAUSED,
+			Paused:     info.Status == container.PAUSED,
+			Restarting: info.Status == container.RESTARTING,
+			OOMKilled:  info.OOMKilled,
+			Pid:        pid,
+			ExitCode:   info.ExitCode,
+			StartedAt:  info.StartedAt,
+			FinishedAt: info.FinishedAt,
+		},
+		RestartCount: info.RestartCount,
+		LogPath:      fmt.Sprintf(container.DefaultInfoLocation, info.ID) + container.ContainerLogFile,
+		HostConfig: hostConfig{
+			RestartPolicy: restartPolicy{
+				Name:              info.RestartPolicy.Name,
+				MaximumRetryCount: info.RestartPolicy.MaximumRetryCount,
+			},
+			AutoRemove: info.AutoRemove,
+			LogConfig:  logConfig{MaxSize: info.LogMaxSize, MaxFiles: info.LogMaxFiles},
+		},
+		Config: containerConfig{
+			Cmd:        info.Command,
+			Image:      info.Image,
+			Tty:        info.Tty,
+			StopSignal: info.StopSignal,
+			Labels:     info.Labels,
+		},
+		GraphDriver: graphDriver{
+			Name: "aufs",
+			Data: map[string]string{
+				"LowerDir":  container.ImageLayerURL(info.Image),
+				"UpperDir":  fmt.Sprintf(container.WriteLayerUrl, info.ID),
+				"MergedDir": fmt.Sprintf(container.MntURL, info.ID),
+			},
+		},
+		Mounts: []mountPoint{},
+		NetworkSettings: networkSettings{
+			Ports:    portBindings(info.PortMapping),
+			Networks: map[string]endpointSettings{},
+		},
+	}
+	result.HostConfig.PortBindings = result.NetworkSettings.Ports
+	for _, ep := range info.Endpoints {
+		result.NetworkSettings.Networks[ep.Network] = endpointSettings{
+			EndpointID: ep.ID,
+			IPAddress:  ep.IPAddress,
+			Device:     ep.Device,
+		}
+		if result.NetworkSettings.IPAddress == "" {
+			result.NetworkSettings.IPAddress = ep.IPAddress
+		}
+	}
+	if info.RestartPolicy.IsNone() {
+		result.HostConfig.RestartPolicy.Name = container.RestartNo
+	}
+	if len(info.Command) > 0 {
+		result.Path, result.Args = info.Command[0], info.Command[1:]
+	}
+	if res := info.Resource; res != nil {
+		result.HostConfig.Memory = res.MemoryLimit
+		result.HostConfig.CpuShares = res.CpuShare
+		result.HostConfig.CpusetCpus = res.CpuSet
+		result.HostConfig.PidsLimit = res.PidsLimit
+	}
+	if config := info.Config; config != nil {
+		result.Config.Hostname = config.Hostname
+		result.Config.User = config.User
+		result.Config.Env = config.Env
+		result.Config.WorkingDir = config.Cwd
+		result.Config.Init = config.Init
+	}
+	if volumeURLs := strings.Split(info.Volume, ":"); len(volumeURLs) == 2 {
+		// 匿名数据卷不是用户指定的 bind
+		mountType := "bind"
+		if len(info.AnonymousVolumes) > 0 && info.AnonymousVolumes[0] == volumeURLs[0] {
+			mountType = "volume"
+		} else {
+			result.HostConfig.Binds = []string{info.Volume}
+		}
+		result.Mounts = append(result.Mounts, mountPoint{Type: mountType, Source: volumeURLs[0], Destination: volumeURLs[1]})
+	}
+	return result, nil
+}
+
+// 将 -p 的端口映射转换为 docker 的格式，如 8080:80 转换为 80/tcp -> 0.0.0.0:8080
+func portBindings(portMapping []string) map[string][]portBinding {
+	ports := map[string][]portBinding{}
+	for _, pm := range portMapping {
+		portPair := strings.Split(pm, ":")
+		if len(portPair) != 2 {
+			continue
+		}
+		key := portPair[1] + "/tcp"
+		ports[key] = append(ports[key], portBinding{HostIp: "0.0.0.0", HostPort: portPair[0]})
+	}
+	return ports
+}
+
+// 镜像不存在时返回 nil
+func inspectImage(name string) (interface{}, error) {
+	if container.ValidateImageName(name) != nil {
+		return nil, nil
+	}
+	tarURL := container.ImageTarURL(name)
+	stat, err := os.Stat(tarURL)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	f, err := os.Open(tarURL)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	hash := sha256.New()
+	if _, err := io.Copy(hash, f); err != nil {
+		return nil, fmt.Errorf("read image %s error %v", tarURL, err)
+	}
+
+	config, err := container.LoadImageConfig(name)
+	if err != nil {
+		return nil, fmt.Errorf("read config of image %s error %v", name, err)
+	}
+
+	imageName, tag := container.ParseImageName(name)
+	result := &imageInspect{
+		Id:       "sha256:" + hex.EncodeToString(hash.Sum(nil)),
+		RepoTags: []string{imageName + ":" + tag},
+		Created:  stat.ModTime(),
+		Size:     stat.Size(),
+		Archive:  tarURL,
+		Config:   imageConfig{Labels: config.Labels},
+	}
+	if exist, _ := container.PathExists(container.ImageLayerURL(name)); exist {
+		result.RootFS = container.ImageLayerURL(name)
+	}
+	return result, nil
+}
+
+// 网络不存在时返回 nil
+func inspectNetwork(name string) (interface{}, error) {
+	nw, err := network.GetNetwork(name)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	result := &networkInspect{Name: nw.Name, Driver: nw.Driver}
+	if nw.IpRange != nil {
+		result.Subnet = nw.IpRange.String()
+		result.Gateway = nw.IpRange.IP.String()
+	}
+	return result, nil
+}
+
+// 没有容器使用该目录作为数据卷时返回 nil
+func inspectVolume(name string) (interface{}, error) {
+	containers, err := state.List()
+	if err != nil {
+		return nil, err
+	}
+	name = filepath.Clean(name)
+	result := &volumeInspect{Name: name, Driver: "local", Mountpoint: name}
+	for _, info := range containers {
+		volumeURLs := strings.Split(info.Volume, ":")
+		if len(volumeURLs) == 2 && volumeURLs[0] != "" && filepath.Clean(volumeURLs[0]) == name {
+			result.UsedBy = append(result.UsedBy, info.Name)
+		}
+	}
+	if len(result.UsedBy) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
+// 解析 --format 的模板，提供与 docker 相同的 json、join 等函数
+func parseFormat(format string) (*template.Template, error) {
+	funcs := template.FuncMap{
+		"json": func(v interface{}) (string, error) {
+			data, err := json.Marshal(v)
+			return string(data), err
+		},
+		"join":  joinValues,
+		"upper": strings.ToUpper,
+		"lower": strings.ToLower,
+	}
+	tmpl, err := template.New("format").Funcs(funcs).Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("parse format %q error %v", format, err)
+	}
+	return tmpl, nil
+}
+
+// 使用模板输出对象，每个对象一行
+// 先转换为 json 的 map，模板中使用与 json 输出相同的字段名
+func executeFormat(tmpl *template.Template, obj interface{}, out io.Writer) error {
+	data, err := json.Marshal(obj)
+	if err != nil {
+		return err
+	}
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, value); err != nil {
+		return fmt.Errorf("execute format error %v", err)
+	}
+	buf.WriteString("\n")
+	_, err = out.Write(buf.Bytes())
+	return err
+}
+
+// 模板中的 join，数组在转换为 json 的 map 之后为 []interface{}
+func joinValues(v interface{}, sep string) string {
+	var items []string
+	switch values := v.(type) {
+	case []string:
+		items = values
+	case []interface{}:
+		for _, value := range values {
+			items = append(items, fmt.Sprint(value))
+		}
+	default:
+		return fmt.Sprint(v)
+	}
+	return strings.Join(items, sep)
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestExecuteFormat(t *testing.T) {
+	type state struct {
+		Status   string
+		ExitCode int
+	}
+	obj := struct {
+		Name   string
+		Args   []string
+		State  state
+		Labels map[string]string
+	}{
+		Name:   "web",
+		Args:   []string{"-c", "top"},
+		State:  state{Status: "exited", ExitCode: 137},
+		Labels: map[string]string{"env": "prod"},
+	}
+	tests := []struct {
+		name     string
+		format   string
+		want     string
+		parseErr bool
+		execErr  bool
+	}{
+		{name: "field", format: "{{.Name}}", want: "web\n"},
+		{name: "nested field", format: "{{.State.Status}} {{.State.ExitCode}}", want: "exited 137\n"},
+		{name: "map key", format: "{{.Labels.env}}", want: "prod\n"},
+		{name: "index", format: `{{index .Labels "env"}}`, want: "prod\n"},
+		{name: "json", format: "{{json .State}}", want: `{"ExitCode":137,"Status":"exited"}` + "\n"},
+		{name: "join", format: `{{join .Args " "}}`, want: "-c top\n"},
+		{name: "upper", format: "{{upper .Name}}", want: "WEB\n"},
+		{name: "bad template", format: "{{.Name", parseErr: true},
+		{name: "unknown function", format: "{{foo .Name}}", parseErr: true},
+		{name: "bad call", format: "{{join .Name}}", execErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tmpl, err := parseFormat(tt.format)
+			if tt.parseErr {
+				if err == nil {
+					t.Fatalf("parseFormat(%q) want error", tt.format)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseFormat(%q) error %v", tt.format, err)
+			}
+			var out bytes.Buffer
+			err = executeFormat(tmpl, obj, &out)
+			if tt.execErr {
+				if err == nil {
+					t.Fatalf("executeFormat(%q) = %q, want error", tt.format, out.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("executeFormat(%q) error %v", tt.format, err)
+			}
+			if out.String() != tt.want {
+				t.Errorf("executeFormat(%q) = %q, want %q", tt.format, out.String(), tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,29 @@
+package testutil
+
+import (
+	"copyDocker/container"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 15:30 2022/3/31
+ @Description: 测试用的数据目录
+*/
+
+// SetupRoot 将持久化数据与运行期数据的目录指向新的临时目录，测试结束后恢复默认目录并删除临时目录
+func SetupRoot(t *testing.T) string {
+	root, err := ioutil.TempDir("", "copyDocker-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	container.SetPaths(filepath.Join(root, "lib"), filepath.Join(root, "run"))
+	t.Cleanup(func() {
+		container.SetPaths(container.DefaultRootDir, container.DefaultStateDir)
+		os.RemoveAll(root)
+	})
+	return root
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"bufio"
+	"copyDocker/container"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strings"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 19:30 2022/3/29
+ @Description: 容器与镜像的标签
+*/
+
+// 解析 --label-file 与 --label，后者覆盖前者
+// 标签为 key=value，只有 key 时值为空；标签文件中每行一个，忽略空行与 # 开头的注释
+func parseLabels(labels, labelFiles []string) (map[string]string, error) {
+	var all []string
+	for _, file := range labelFiles {
+		lines, err := readLabelFile(file)
+		if err != nil {
+			return nil, err
+		}
+		all = append(all, lines...)
+	}
+	all = append(all, labels...)
+
+	result := map[string]string{}
+	for _, label := range all {
+		kv := strings.SplitN(label, "=", 2)
+		if kv[0] == "" {
+			return nil, fmt.Errorf("invalid label %q, expected key=value", label)
+		}
+		if len(kv) == 1 {
+			result[kv[0]] = ""
+			continue
+		}
+		result[kv[0]] = kv[1]
+	}
+	return result, nil
+}
+
+func readLabelFile(file string) ([]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("open label file %s error %v", file, err)
+	}
+	defer f.Close()
+
+	var lines []string
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read label file %s error %v", file, err)
+	}
+	return lines, nil
+}
+
+// 合并标签，后面的覆盖前面的
+func mergeLabels(labels ...map[string]string) map[string]string {
+	result := map[string]string{}
+	for _, l := range labels {
+		for k, v := range l {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// 镜像的标签，失败时返回空
+func imageLabels(image string) map[string]string {
+	config, err := container.LoadImageConfig(image)
+	if err != nil {
+		logrus.Warnf("Load config of image %s error %v", image, err)
+		return nil
+	}
+	return config.Labels
+}
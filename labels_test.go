@@ -0,0 +1,92 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseLabels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "copyDocker-labels")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	labelFile := filepath.Join(dir, "labels")
+	content := "# 注释\n\nenv=dev\n  team=infra  \nempty\n"
+	if err := ioutil.WriteFile(labelFile, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		labels     []string
+		labelFiles []string
+		want       map[string]string
+		wantErr    bool
+	}{
+		{name: "none", want: map[string]string{}},
+		{
+			name:   "key and value",
+			labels: []string{"env=prod", "url=http://a?b=c"},
+			want:   map[string]string{"env": "prod", "url": "http://a?b=c"},
+		},
+		{name: "key only", labels: []string{"debug"}, want: map[string]string{"debug": ""}},
+		{name: "empty value", labels: []string{"env="}, want: map[string]string{"env": ""}},
+		{
+			name:       "file",
+			labelFiles: []string{labelFile},
+			want:       map[string]string{"env": "dev", "team": "infra", "empty": ""},
+		},
+		{
+			name:       "label overrides file",
+			labels:     []string{"env=prod"},
+			labelFiles: []string{labelFile},
+			want:       map[string]string{"env": "prod", "team": "infra", "empty": ""},
+		},
+		{name: "empty key", labels: []string{"=prod"}, wantErr: true},
+		{name: "missing file", labelFiles: []string{filepath.Join(dir, "missing")}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := parseLabels(tt.labels, tt.labelFiles)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parseLabels() = %v, want error", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLabels() error %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMergeLabels(t *testing.T) {
+	tests := []struct {
+		name   string
+		labels []map[string]string
+		want   map[string]string
+	}{
+		{name: "none", want: map[string]string{}},
+		{name: "nil image labels", labels: []map[string]string{nil, {"env": "prod"}}, want: map[string]string{"env": "prod"}},
+		{
+			name:   "later overrides",
+			labels: []map[string]string{{"env": "dev", "team": "infra"}, {"env": "prod"}},
+			want:   map[string]string{"env": "prod", "team": "infra"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mergeLabels(tt.labels...); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("mergeLabels() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,11 +2,11 @@ package main
 
 import (
 	"copyDocker/container"
-	"encoding/json"
+	"copyDocker/state"
 	"fmt"
-	"github.com/sirupsen/logrus"
-	"io/ioutil"
 	"os"
+	"sort"
+	"strings"
 	"text/tabwriter"
 )
 
@@ -16,63 +16,187 @@ import (
  @Description: docker ps的实现
 */
 
-func ListContainer() {
-	// 找到存储容器信息的路径 /var/run/copyDocker/${}/
-	dirURL := fmt.Sprintf(container.DefaultInfoLocation, "")
-	dirURL = dirURL[:len(dirURL)-1]
-	// 读取该文件下的所有文件
-	files, err := ioutil.ReadDir(dirURL)
+// 默认输出中命令截断后的长度，ID 截断为短 ID
+const truncCommandLength = 20
+
+// ListOptions ps 命令的参数
+type ListOptions struct {
+	All     bool                // 是否显示所有容器，默认只显示运行中的容器
+	Quiet   bool                // 只输出容器 ID
+	NoTrunc bool                // 不截断 ID 与命令
+	Filters map[string][]string // --filter key=value，同一个 key 的多个值满足其一即可
+	Format  string              // Go 模板
+}
+
+// ps --format 中可以使用的字段
+type psRow struct {
+	ID           string
+	Names        string
+	Image        string
+	Command      string
+	CreatedAt    string
+	Status       string
+	State        string
+	Pid          string
+	RestartCount int
+	Labels       string
+}
+
+// ps 支持的过滤条件
+var psFilterKeys = map[string]bool{"status": true, "name": true, "label": true, "ancestor": true}
+
+// ParseFilters 解析 key=value 形式的过滤条件
+func ParseFilters(filters []string, validKeys map[string]bool) (map[string][]string, error) {
+	result := map[string][]string{}
+	for _, filter := range filters {
+		kv := strings.SplitN(filter, "=", 2)
+		if len(kv) != 2 || kv[1] == "" {
+			return nil, fmt.Errorf("bad format of filter %s, expected key=value", filter)
+		}
+		if !validKeys[kv[0]] {
+			return nil, fmt.Errorf("invalid filter %s", kv[0])
+		}
+		result[kv[0]] = append(result[kv[0]], kv[1])
+	}
+	return result, nil
+}
+
+func ListContainer(opts *ListOptions) error {
+	containers, err := state.List()
 	if err != nil {
-		logrus.Errorf("Read dir %s error %v.", dirURL, err)
-		return
+		return err
 	}
-	var containers []*container.ContainerInfo
-	for _, v := range files {
-		conInfo,err:=getContainerInfo(v)
-		if err!=nil{
-			logrus.Errorf("Get containerInfo error:",err)
+	var rows []*psRow
+	for _, info := range containers {
+		// 指定了 status 时，不再只显示运行中的容器
+		if !opts.All && len(opts.Filters["status"]) == 0 && !info.IsRunning() {
+			continue
+		}
+		if !matchContainerFilters(info, opts.Filters) {
 			continue
 		}
-		containers = append(containers, conInfo)
+		rows = append(rows, newPsRow(info, opts.NoTrunc))
+	}
+
+	if opts.Quiet {
+		for _, row := range rows {
+			fmt.Println(row.ID)
+		}
+		return nil
+	}
+	if opts.Format != "" {
+		tmpl, err := parseFormat(opts.Format)
+		if err != nil {
+			return err
+		}
+		for _, row := range rows {
+			if err := executeFormat(tmpl, row, os.Stdout); err != nil {
+				return err
+			}
+		}
+		return nil
 	}
-	w:=tabwriter.NewWriter(os.Stdout,12,1,3,' ',0)
+
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
 	// 直接在控制台出信息
-	fmt.Fprint(w,"ID\tNAME\tPID\tStatus\tCommand\tCreated\n")
-	for _,itme:=range containers{
+	fmt.Fprint(w, "ID\tNAME\tIMAGE\tPID\tStatus\tRestarts\tCommand\tCreated\n")
+	for _, row := range rows {
 		// 打印出来
-		fmt.Fprintf(w,"%s\t%s\t%s\t%s\t%s\t%s\n",
-			itme.ID,
-			itme.Name,
-			itme.Pid,
-			itme.Status,
-			itme.Command,
-			itme.CreatedTime,
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%d\t%s\t%s\n",
+			row.ID,
+			row.Names,
+			row.Image,
+			row.Pid,
+			row.Status,
+			row.RestartCount,
+			row.Command,
+			row.CreatedAt,
 		)
 	}
 	if err := w.Flush(); err != nil {
-		logrus.Errorf("Flush error:%v",err)
-		return
+		return fmt.Errorf("flush error %v", err)
+	}
+	return nil
+}
+
+// ps 输出的一行
+func newPsRow(info *container.ContainerInfo, noTrunc bool) *psRow {
+	row := &psRow{
+		ID:           info.ID,
+		Names:        info.Name,
+		Image:        info.Image,
+		Command:      strings.Join(info.Command, " "),
+		CreatedAt:    info.CreatedTime,
+		Status:       containerStatus(info),
+		State:        info.Status,
+		Pid:          info.Pid,
+		RestartCount: info.RestartCount,
+		Labels:       joinLabels(info.Labels),
+	}
+	if !noTrunc {
+		row.ID = shortID(row.ID)
+		if len(row.Command) > truncCommandLength {
+			row.Command = row.Command[:truncCommandLength-3] + "..."
+		}
 	}
+	return row
 }
 
-// 从文件获取存储的容器信息
-func getContainerInfo(file os.FileInfo) (*container.ContainerInfo, error) {
-	// Name
-	containerName := file.Name()
-	// 绝对路径
-	configFileDir := fmt.Sprintf(container.DefaultInfoLocation, containerName)
-	configFileDir = configFileDir + container.ConfigName
-
-	// 读取信息
-	ctx, err := ioutil.ReadFile(configFileDir)
-	if err!=nil{
-		logrus.Errorf("Read file %s error: %v",configFileDir,err)
-		return nil, err
+// 判断容器是否满足所有的过滤条件，不同 key 之间为且，同一个 key 的多个值之间为或
+func matchContainerFilters(info *container.ContainerInfo, filters map[string][]string) bool {
+	for key, values := range filters {
+		matched := false
+		for _, value := range values {
+			if matchContainerFilter(info, key, value) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
 	}
-	var info container.ContainerInfo
-	if err := json.Unmarshal(ctx, &info); err != nil {
-		logrus.Errorf("Json unMarshal error:",err)
-		return nil,err
+	return true
+}
+
+func matchContainerFilter(info *container.ContainerInfo, key, value string) bool {
+	switch key {
+	case "status":
+		return info.Status == value
+	case "name":
+		return strings.Contains(info.Name, value)
+	case "ancestor":
+		return container.ImageStoreName(info.Image) == container.ImageStoreName(value)
+	case "label":
+		return matchLabel(info.Labels, value)
+	}
+	return false
+}
+
+// label=key 或 label=key=value
+func matchLabel(labels map[string]string, filter string) bool {
+	kv := strings.SplitN(filter, "=", 2)
+	value, ok := labels[kv[0]]
+	if len(kv) == 1 {
+		return ok
+	}
+	return ok && value == kv[1]
+}
+
+// 以 k=v,k=v 的形式输出标签
+func joinLabels(labels map[string]string) string {
+	var items []string
+	for k, v := range labels {
+		items = append(items, k+"="+v)
+	}
+	sort.Strings(items)
+	return strings.Join(items, ",")
+}
+
+// ps 中显示的状态，已退出的容器附带退出码
+func containerStatus(info *container.ContainerInfo) string {
+	if info.Status == container.Exit {
+		return fmt.Sprintf("%s (%d)", info.Status, info.ExitCode)
 	}
-	return &info,nil
+	return info.Status
 }
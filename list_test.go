@@ -0,0 +1,86 @@
+package main
+
+import (
+	"copyDocker/container"
+	"reflect"
+	"testing"
+)
+
+func TestParseFilters(t *testing.T) {
+	tests := []struct {
+		name    string
+		filters []string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{name: "empty", want: map[string][]string{}},
+		{
+			name:    "multiple values",
+			filters: []string{"status=running", "status=paused", "name=web"},
+			want:    map[string][]string{"status": {"running", "paused"}, "name": {"web"}},
+		},
+		{
+			name:    "value with equal sign",
+			filters: []string{"label=env=prod"},
+			want:    map[string][]string{"label": {"env=prod"}},
+		},
+		{name: "missing value", filters: []string{"status="}, wantErr: true},
+		{name: "missing equal sign", filters: []string{"status"}, wantErr: true},
+		{name: "unknown key", filters: []string{"since=web"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseFilters(tt.filters, psFilterKeys)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseFilters(%q) = %v, want error", tt.filters, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFilters(%q) error %v", tt.filters, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFilters(%q) = %v, want %v", tt.filters, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMatchContainerFilters(t *testing.T) {
+	info := &container.ContainerInfo{
+		Name:   "web-1",
+		Image:  "busybox",
+		Status: container.RUNNING,
+		Labels: map[string]string{"env": "prod", "team": ""},
+	}
+	tests := []struct {
+		name    string
+		filters map[string][]string
+		want    bool
+	}{
+		{name: "no filter", want: true},
+		{name: "status", filters: map[string][]string{"status": {container.RUNNING}}, want: true},
+		{name: "other status", filters: map[string][]string{"status": {container.Exit}}},
+		{name: "any of values", filters: map[string][]string{"status": {container.Exit, container.RUNNING}}, want: true},
+		{name: "name substring", filters: map[string][]string{"name": {"web"}}, want: true},
+		{name: "other name", filters: map[string][]string{"name": {"db"}}},
+		{name: "ancestor with tag", filters: map[string][]string{"ancestor": {"busybox:latest"}}, want: true},
+		{name: "other ancestor", filters: map[string][]string{"ancestor": {"alpine"}}},
+		{name: "label key", filters: map[string][]string{"label": {"team"}}, want: true},
+		{name: "label key and value", filters: map[string][]string{"label": {"env=prod"}}, want: true},
+		{name: "label other value", filters: map[string][]string{"label": {"env=dev"}}},
+		{name: "missing label", filters: map[string][]string{"label": {"owner"}}},
+		{
+			name:    "all keys must match",
+			filters: map[string][]string{"status": {container.RUNNING}, "name": {"db"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := matchContainerFilters(info, tt.filters); got != tt.want {
+				t.Errorf("matchContainerFilters(%v) = %v, want %v", tt.filters, got, tt.want)
+			}
+		})
+	}
+}
@@ -3,8 +3,7 @@ package main
 import (
 	"copyDocker/container"
 	"fmt"
-	"github.com/sirupsen/logrus"
-	"io/ioutil"
+	"io"
 	"os"
 )
 
@@ -14,26 +13,40 @@ import (
  @Description: 查看容器 log 的具体实现
 */
 
-func logContainer(containerName string) {
+// 依次输出轮转后的日志文件与当前的日志文件
+func logContainer(containerName string) error {
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
 	// 对应文件夹的位置
-	dirURL := fmt.Sprintf(container.DefaultInfoLocation, containerName)
-	// /var/run/copyDocker/${}/container.log
+	dirURL := fmt.Sprintf(container.DefaultInfoLocation, info.ID)
+	// ${root}/containers/${id}/container.log
 	logFileLocation := dirURL + container.ContainerLogFile
-	// 日志文件的打开
-	file, err := os.Open(logFileLocation)
-	defer file.Close()
-	if err != nil {
-		logrus.Errorf("Log container open file %s error %v", logFileLocation, err)
-		return
+	logFiles := container.LogFiles(logFileLocation)
+	if len(logFiles) == 0 {
+		return fmt.Errorf("log file %s does not exist", logFileLocation)
+	}
+	for _, logFile := range logFiles {
+		if err := copyFile(os.Stdout, logFile); err != nil {
+			return err
+		}
 	}
+	return nil
+}
 
-	// read
-	content, err := ioutil.ReadAll(file)
+// 将文件的内容写入 w，读取期间被轮转删除的文件跳过
+func copyFile(w io.Writer, fileName string) error {
+	file, err := os.Open(fileName)
 	if err != nil {
-		logrus.Errorf("Log container read file %s error %v", logFileLocation, err)
-		return
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return fmt.Errorf("open log file %s error %v", fileName, err)
 	}
-
-	fmt.Fprint(os.Stdout, string(content))
-
+	defer file.Close()
+	if _, err := io.Copy(w, file); err != nil {
+		return fmt.Errorf("read log file %s error %v", fileName, err)
+	}
+	return nil
 }
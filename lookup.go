@@ -0,0 +1,74 @@
+package main
+
+import (
+	"copyDocker/container"
+	"copyDocker/state"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 21:10 2022/3/29
+ @Description: 通过完整 ID、唯一的 ID 前缀或名字查找容器
+*/
+
+// 容器名的格式，与 docker 相同，保证可以直接作为目录名
+var validContainerName = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]+$`)
+
+// 找不到容器时返回的错误，inspect 据此继续查找其它类型的对象
+type noSuchContainerError struct {
+	ref string
+}
+
+func (e *noSuchContainerError) Error() string {
+	return fmt.Sprintf("no such container: %s", e.ref)
+}
+
+// 查找容器
+func lookupContainer(ref string) (*container.ContainerInfo, error) {
+	containers, err := state.List()
+	if err != nil {
+		return nil, err
+	}
+	return matchContainer(ref, containers)
+}
+
+// 在容器中依次匹配完整 ID、名字、ID 前缀，前缀匹配到多个容器时报错
+func matchContainer(ref string, containers []*container.ContainerInfo) (*container.ContainerInfo, error) {
+	if ref == "" {
+		return nil, fmt.Errorf("container name or ID can not be empty")
+	}
+	for _, info := range containers {
+		if info.ID == ref {
+			return info, nil
+		}
+	}
+	for _, info := range containers {
+		if info.Name == ref {
+			return info, nil
+		}
+	}
+	var matches []*container.ContainerInfo
+	for _, info := range containers {
+		if strings.HasPrefix(info.ID, ref) {
+			matches = append(matches, info)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return nil, &noSuchContainerError{ref: ref}
+	case 1:
+		return matches[0], nil
+	}
+	return nil, fmt.Errorf("multiple containers found with ID prefix %s, use a longer prefix or the name", ref)
+}
+
+// 检查容器名的格式并占用容器名
+func reserveContainerName(name, id string) error {
+	if !validContainerName.MatchString(name) {
+		return fmt.Errorf("invalid container name %q, only [a-zA-Z0-9][a-zA-Z0-9_.-] are allowed", name)
+	}
+	return state.ReserveName(name, id)
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"copyDocker/container"
+	"testing"
+)
+
+func TestMatchContainer(t *testing.T) {
+	containers := []*container.ContainerInfo{
+		{ID: "abc123", Name: "web"},
+		{ID: "abd456", Name: "db"},
+		{ID: "ffe789", Name: "abd"},
+	}
+	tests := []struct {
+		ref      string
+		want     string // 找到的容器 ID
+		notFound bool
+		wantErr  bool
+	}{
+		{ref: "abc123", want: "abc123"},
+		{ref: "web", want: "abc123"},
+		{ref: "abc", want: "abc123"},
+		{ref: "ff", want: "ffe789"},
+		// 名字优先于 ID 前缀
+		{ref: "abd", want: "ffe789"},
+		{ref: "ab", wantErr: true},
+		{ref: "a", wantErr: true},
+		{ref: "zzz", notFound: true},
+		{ref: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			info, err := matchContainer(tt.ref, containers)
+			if tt.notFound {
+				if _, ok := err.(*noSuchContainerError); !ok {
+					t.Fatalf("matchContainer(%q) error = %v, want no such container", tt.ref, err)
+				}
+				return
+			}
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("matchContainer(%q) = %s, want error", tt.ref, info.ID)
+				}
+				if _, ok := err.(*noSuchContainerError); ok {
+					t.Fatalf("matchContainer(%q) error = %v, want ambiguous", tt.ref, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("matchContainer(%q) error %v", tt.ref, err)
+			}
+			if info.ID != tt.want {
+				t.Errorf("matchContainer(%q) = %s, want %s", tt.ref, info.ID, tt.want)
+			}
+		})
+	}
+}
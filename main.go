@@ -7,6 +7,9 @@ package main
 */
 
 import (
+	"copyDocker/container"
+	"copyDocker/network"
+	"copyDocker/state"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	"os"
@@ -29,19 +32,68 @@ func main() {
 		listCommand,
 		logCommand,
 		stopCommand,
+		waitCommand,
+		killCommand,
+		pauseCommand,
+		unpauseCommand,
+		startCommand,
+		restartCommand,
+		renameCommand,
+		updateCommand,
 		execCommand,
 		removeCommand,
+		diffCommand,
+		inspectCommand,
+		copyCommand,
+		exportCommand,
+		importCommand,
+		containerCommand,
+		imageCommand,
+		systemCommand,
+	}
+
+	// 数据目录，monitor 与 init 等子进程继承相同的命令行参数与环境变量
+	app.Flags = []cli.Flag{
+		cli.StringFlag{
+			Name:   "root",
+			Usage:  "root directory of persistent data: images, containers, write layers and networks",
+			Value:  container.DefaultRootDir,
+			EnvVar: "COPYDOCKER_ROOT",
+		},
+		cli.StringFlag{
+			Name:   "state",
+			Usage:  "directory of runtime data such as container mount points",
+			Value:  container.DefaultStateDir,
+			EnvVar: "COPYDOCKER_STATE",
+		},
 	}
 
 	app.Before = func(ctx *cli.Context) error {
 		logrus.SetFormatter(&logrus.JSONFormatter{})
 
 		logrus.SetOutput(os.Stdout)
+
+		container.SetPaths(ctx.GlobalString("root"), ctx.GlobalString("state"))
+		network.SetRoot(container.RootDir)
+		// init 运行在容器中，system migrate 本身即为迁移
+		if cmd := ctx.Args().First(); cmd != "init" {
+			if err := container.CreatePaths(); err != nil {
+				logrus.Warnf("Create directories under %s error %v", container.RootDir, err)
+			}
+			if cmd != "system" {
+				warnLegacyLayout()
+			}
+			// 读取容器信息之前，先将之前版本的容器迁移到当前格式，加锁进行
+			if err := state.Migrate(); err != nil {
+				logrus.Warnf("Migrate containers error %v", err)
+			}
+		}
 		return nil
 	}
 
-	// 进行执行
+	// 进行执行，命令通过 cli.ExitCoder 指定的退出码在 app.Run 中直接退出
 	if err := app.Run(os.Args); err != nil {
-		panic(err)
+		logrus.Errorf("%v", err)
+		os.Exit(1)
 	}
 }
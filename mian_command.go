@@ -3,10 +3,13 @@ package main
 import (
 	"copyDocker/cgroups/subsystems"
 	"copyDocker/container"
+	"copyDocker/state"
 	"fmt"
 	"github.com/sirupsen/logrus"
 	"github.com/urfave/cli"
 	"os"
+	"path/filepath"
+	"time"
 )
 
 /*
@@ -41,10 +44,14 @@ var runCommand = cli.Command{
 			Name:  "cpuset",
 			Usage: "cpuset limit",
 		},
+		cli.IntFlag{
+			Name:  "pids-limit",
+			Usage: "pids limit, 0 or -1 for unlimited",
+		},
 		// 添加 -v 的标签
 		cli.StringFlag{
 			Name:  "v",
-			Usage: "volume",
+			Usage: "volume, host_dir:container_dir, or container_dir for an anonymous volume",
 		},
 		// -name 提供容器 name
 		cli.StringFlag{
@@ -52,9 +59,55 @@ var runCommand = cli.Command{
 			Usage: "container name",
 		},
 		cli.StringSliceFlag{
-			Name: "e",
+			Name:  "e",
 			Usage: "set env",
 		},
+		cli.StringFlag{
+			Name:  "user, u",
+			Usage: "username or UID (format: <name|uid>[:<group|gid>])",
+		},
+		cli.StringFlag{
+			Name:  "workdir, w",
+			Usage: "working directory inside the container",
+		},
+		cli.StringFlag{
+			Name:  "hostname",
+			Usage: "container host name, default to container id",
+		},
+		cli.BoolFlag{
+			Name:  "rm",
+			Usage: "automatically remove the container when it exits",
+		},
+		cli.StringFlag{
+			Name:  "stop-signal",
+			Usage: "signal to stop the container, default to the stop signal of the image or SIGTERM",
+		},
+		cli.StringFlag{
+			Name:  "restart",
+			Usage: "restart policy when the container exits: no, on-failure[:max-retries], always, unless-stopped",
+			Value: container.RestartNo,
+		},
+		cli.StringFlag{
+			Name:  "log-max-size",
+			Usage: "rotate the log of a detached container when it reaches the size (e.g. 10m), default unlimited",
+		},
+		cli.IntFlag{
+			Name:  "log-max-files",
+			Usage: "max number of log files kept for a detached container",
+			Value: 1,
+		},
+		cli.BoolFlag{
+			Name:  "init",
+			Usage: "run an init inside the container that forwards signals and reaps processes",
+		},
+		cli.StringSliceFlag{
+			Name:  "label",
+			Usage: "set metadata on the container (key=value)",
+		},
+		cli.StringSliceFlag{
+			Name:  "label-file",
+			Usage: "read in a line delimited file of labels",
+		},
 	},
 	// 正在 run 的函数
 	// 1. 判断用户是否包含 command
@@ -71,27 +124,157 @@ var runCommand = cli.Command{
 
 		tty := ctx.Bool("ti")
 		detach := ctx.Bool("d")
+		if workdir := ctx.String("workdir"); workdir != "" && !filepath.IsAbs(workdir) {
+			return fmt.Errorf("the working directory %s is invalid, it needs to be an absolute path", workdir)
+		}
 
 		// terminal 和 detach 不能共存
 		if tty && detach {
 			return fmt.Errorf("ti and d paramter can not both provited")
 		}
+		logMaxSize, err := container.ParseSize(ctx.String("log-max-size"))
+		if err != nil {
+			return err
+		}
+		restartPolicy, err := container.ParseRestartPolicy(ctx.String("restart"))
+		if err != nil {
+			return err
+		}
+		if stopSignal := ctx.String("stop-signal"); stopSignal != "" {
+			if _, err := container.ParseSignal(stopSignal); err != nil {
+				return err
+			}
+		}
+		labels, err := parseLabels(ctx.StringSlice("label"), ctx.StringSlice("label-file"))
+		if err != nil {
+			return err
+		}
+		// 重启由后台的 monitor 负责
+		if !restartPolicy.IsNone() && (tty || ctx.Bool("rm")) {
+			return fmt.Errorf("restart policy can not be used with ti or rm")
+		}
+		if _, err := container.ParseSize(ctx.String("m")); err != nil {
+			return fmt.Errorf("invalid memory limit %s", ctx.String("m"))
+		}
+		imageName := cmdArray[0]
+		if err := container.ValidateImageName(imageName); err != nil {
+			return err
+		}
+		cmdArray = cmdArray[1:]
+		if len(cmdArray) < 1 {
+			return fmt.Errorf("Missing container command")
+		}
+		// 参数都检查完之后再创建 monitor，后台运行时用户才能直接看到参数错误
+		// 后台运行的容器交给 monitor 进程创建和等待
+		isMonitor := initMonitor()
+		if !tty && !isMonitor {
+			if err := startMonitor(); err != nil {
+				logrus.Errorf("Run container error %v", err)
+				return cli.NewExitError("", runErrorExitCode)
+			}
+			return nil
+		}
 		logrus.Infof("CreateTry %v", tty)
 		volume := ctx.String("v")
 
 		// 将容器名传递下去
 		containerName := ctx.String("name")
 
-		imageName:=cmdArray[0]
-		cmdArray=cmdArray[1:]
-
-		envSlice:=ctx.StringSlice("e")
+		// 传递给 init 进程的配置
+		initConfig := &container.InitConfig{
+			Args:     cmdArray,
+			Env:      containerEnv(imageName, ctx.StringSlice("e")),
+			Cwd:      ctx.String("workdir"),
+			Hostname: ctx.String("hostname"),
+			Mounts:   container.DefaultMounts,
+			User:     ctx.String("user"),
+			Init:     ctx.Bool("init"),
+		}
 
-		Run(tty, cmdArray, volume, &subsystems.ResourceConfig{
+		resource := &subsystems.ResourceConfig{
 			MemoryLimit: ctx.String("m"),
-			CpuShare:    ctx.String("cpuset"),
-			CpuSet:      ctx.String("cpushare"),
-		}, containerName,imageName,envSlice)
+			CpuShare:    ctx.String("cpushare"),
+			CpuSet:      ctx.String("cpuset"),
+		}
+		if ctx.IsSet("pids-limit") {
+			resource.PidsLimit = pidsLimit(ctx.Int("pids-limit"))
+		}
+
+		opts := &RunOptions{
+			Tty:           tty,
+			AutoRemove:    ctx.Bool("rm"),
+			Volume:        volume,
+			ContainerName: containerName,
+			ImageName:     imageName,
+			Resource:      resource,
+			LogMaxSize:    logMaxSize,
+			LogMaxFiles:   ctx.Int("log-max-files"),
+
+			RestartPolicy: restartPolicy,
+			StopSignal:    ctx.String("stop-signal"),
+			Labels:        labels,
+		}
+		exitCode, err := Run(opts, initConfig)
+		if err != nil {
+			notifyMonitorParent(container.SyncMessage{Type: container.SyncError, Message: err.Error()})
+			logrus.Errorf("Run container error %v", err)
+			return cli.NewExitError("", runErrorExitCode)
+		}
+		// 前台运行时以容器的退出码退出
+		if tty && exitCode != 0 {
+			return cli.NewExitError("", exitCode)
+		}
+		return nil
+	},
+}
+
+// docker wait 等待容器退出，输出退出码
+var waitCommand = cli.Command{
+	Name:  "wait",
+	Usage: "block until one or more containers stop, then print their exit codes",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("Missing container name")
+		}
+		failed := false
+		for _, containerName := range ctx.Args() {
+			exitCode, err := waitContainer(containerName)
+			if err != nil {
+				logrus.Errorf("Wait container %s error %v", containerName, err)
+				failed = true
+				continue
+			}
+			fmt.Println(exitCode)
+		}
+		if failed {
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	},
+}
+
+// docker inspect 输出容器、镜像、网络或数据卷的详细信息
+var inspectCommand = cli.Command{
+	Name:  "inspect",
+	Usage: "return low-level information on containers, images, networks or volumes",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "format, f",
+			Usage: "format the output using the given Go template, e.g. {{.State.Pid}}",
+		},
+		cli.StringFlag{
+			Name:  "type",
+			Usage: "only inspect objects of the given type: container, image, network or volume",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("Missing object name")
+		}
+		if err := inspectObjects(ctx.Args(), ctx.String("type"), ctx.String("format"), os.Stdout); err != nil {
+			logrus.Errorf("Inspect error %v", err)
+			return cli.NewExitError("", 1)
+		}
 		return nil
 	},
 }
@@ -107,7 +290,12 @@ var initCommand = cli.Command{
 	Action: func(ctx *cli.Context) error {
 		logrus.Infof("init come on")
 		logrus.Infof("send in command %s", ctx.Args())
-		return container.RunContainerInitProcess()
+		// 失败的原因已通过同步管道告知父进程，这里直接退出
+		if err := container.RunContainerInitProcess(); err != nil {
+			logrus.Errorf("Init container error %v", err)
+			os.Exit(1)
+		}
+		return nil
 	},
 }
 
@@ -116,23 +304,69 @@ var initCommand = cli.Command{
 var commieCommand = cli.Command{
 	Name:  "commit",
 	Usage: "commit a container into image",
+	Flags: []cli.Flag{labelFlag},
 	Action: func(ctx *cli.Context) error {
 		if len(ctx.Args()) < 2 {
 			return fmt.Errorf("Missing container name and image name")
 		}
-		containerName:=ctx.Args().Get(0)
+		containerName := ctx.Args().Get(0)
 		imageName := ctx.Args().Get(1)
-		commitContainer(containerName,imageName)
+		labels, err := parseLabels(ctx.StringSlice("label"), nil)
+		if err != nil {
+			return err
+		}
+		if err := commitContainer(containerName, imageName, labels); err != nil {
+			logrus.Errorf("Commit container %s error %v", containerName, err)
+			return cli.NewExitError("", 1)
+		}
 		return nil
 	},
 }
 
 var listCommand = cli.Command{
 	Name:  "ps",
-	Usage: "list all the containers",
+	Usage: "list containers, only running ones by default",
+	// 支持 -qa 这样合并的短参数
+	UseShortOptionHandling: true,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "all, a",
+			Usage: "show all containers",
+		},
+		cli.BoolFlag{
+			Name:  "quiet, q",
+			Usage: "only display container IDs",
+		},
+		cli.BoolFlag{
+			Name:  "no-trunc",
+			Usage: "don't truncate output",
+		},
+		cli.StringSliceFlag{
+			Name:  "filter, f",
+			Usage: "filter output: status=, name=, label=, ancestor=",
+		},
+		cli.StringFlag{
+			Name:  "format",
+			Usage: "format the output using the given Go template, e.g. {{.ID}} {{.Names}}",
+		},
+	},
 	Action: func(ctx *cli.Context) error {
+		filters, err := ParseFilters(ctx.StringSlice("filter"), psFilterKeys)
+		if err != nil {
+			return err
+		}
 		// 列出所有的 containerInfo
-		ListContainer()
+		err = ListContainer(&ListOptions{
+			All:     ctx.Bool("all"),
+			Quiet:   ctx.Bool("quiet"),
+			NoTrunc: ctx.Bool("no-trunc"),
+			Filters: filters,
+			Format:  ctx.String("format"),
+		})
+		if err != nil {
+			logrus.Errorf("List containers error %v", err)
+			return cli.NewExitError("", 1)
+		}
 		return nil
 	},
 }
@@ -146,7 +380,10 @@ var logCommand = cli.Command{
 			return fmt.Errorf("Please input container name")
 		}
 		containerName := ctx.Args().Get(0)
-		logContainer(containerName)
+		if err := logContainer(containerName); err != nil {
+			logrus.Errorf("Log container %s error %v", containerName, err)
+			return cli.NewExitError("", 1)
+		}
 		return nil
 	},
 }
@@ -158,7 +395,7 @@ var execCommand = cli.Command{
 	Action: func(ctx *cli.Context) error {
 		// 环境变量 copyDocker_pid 的值
 		if os.Getenv(ENV_EXEC_PID) != "" {
-			logrus.Infof("pid callback pid %s", os.Getpid())
+			logrus.Infof("pid callback pid %d", os.Getpid())
 			return nil
 		}
 		// 命令格式 copyDocker exec containerName cmd
@@ -173,7 +410,10 @@ var execCommand = cli.Command{
 			commandArray = append(commandArray, arg)
 		}
 		// 执行命令
-		ExecContainer(containerName, commandArray)
+		if err := ExecContainer(containerName, commandArray); err != nil {
+			logrus.Errorf("Exec container %s error %v", containerName, err)
+			return cli.NewExitError("", 1)
+		}
 		return nil
 	},
 }
@@ -182,25 +422,523 @@ var execCommand = cli.Command{
 var stopCommand = cli.Command{
 	Name:  "stop",
 	Usage: "Stop a container",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "t, time",
+			Usage: "seconds to wait for stop before killing the container",
+			Value: 10,
+		},
+	},
 	Action: func(ctx *cli.Context) error {
 		if len(ctx.Args()) < 1 {
 			return fmt.Errorf("Missing container name")
 		}
 		containerName := ctx.Args().Get(0)
-		stopContainer(containerName)
+		if err := stopContainer(containerName, time.Duration(ctx.Int("time"))*time.Second); err != nil {
+			logrus.Errorf("Stop container %s error %v.", containerName, err)
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	},
+}
+
+// docker kill 向容器发送信号
+var killCommand = cli.Command{
+	Name:  "kill",
+	Usage: "send a signal to a running container",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "s, signal",
+			Usage: "signal to send to the container",
+			Value: "SIGKILL",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("Missing container name")
+		}
+		sig, err := container.ParseSignal(ctx.String("signal"))
+		if err != nil {
+			return err
+		}
+		containerName := ctx.Args().Get(0)
+		if err := killContainer(containerName, sig); err != nil {
+			logrus.Errorf("Kill container %s error %v", containerName, err)
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	},
+}
+
+// docker start 启动已退出的容器
+var startCommand = cli.Command{
+	Name:  "start",
+	Usage: "start a stopped container",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("Missing container name")
+		}
+		containerName := ctx.Args().Get(0)
+		// 与 run -d 相同，由 monitor 创建并等待容器
+		if initMonitor() {
+			if err := startContainer(containerName); err != nil {
+				notifyMonitorParent(container.SyncMessage{Type: container.SyncError, Message: err.Error()})
+				logrus.Errorf("Start container %s error %v", containerName, err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		}
+		if err := startMonitor(); err != nil {
+			logrus.Errorf("Start container %s error %v", containerName, err)
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	},
+}
+
+// docker restart 停止并重新启动容器
+var restartCommand = cli.Command{
+	Name:  "restart",
+	Usage: "restart a container",
+	Flags: []cli.Flag{
+		cli.IntFlag{
+			Name:  "t, time",
+			Usage: "seconds to wait for stop before killing the container",
+			Value: 10,
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("Missing container name")
+		}
+		containerName := ctx.Args().Get(0)
+		if initMonitor() {
+			if err := startContainer(containerName); err != nil {
+				notifyMonitorParent(container.SyncMessage{Type: container.SyncError, Message: err.Error()})
+				logrus.Errorf("Restart container %s error %v", containerName, err)
+				return cli.NewExitError("", 1)
+			}
+			return nil
+		}
+		timeout := time.Duration(ctx.Int("time")) * time.Second
+		if err := restartContainer(containerName, timeout); err != nil {
+			logrus.Errorf("Restart container %s error %v", containerName, err)
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	},
+}
+
+// docker pause 暂停容器中的所有进程
+var pauseCommand = cli.Command{
+	Name:  "pause",
+	Usage: "pause all processes within a container",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("Missing container name")
+		}
+		containerName := ctx.Args().Get(0)
+		if err := pauseContainer(containerName); err != nil {
+			logrus.Errorf("Pause container %s error %v", containerName, err)
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	},
+}
+
+// docker rename 重命名已停止的容器
+var renameCommand = cli.Command{
+	Name:  "rename",
+	Usage: "rename a stopped container (rename old new)",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 2 {
+			return fmt.Errorf("Missing container name and new name")
+		}
+		containerName := ctx.Args().Get(0)
+		if err := renameContainer(containerName, ctx.Args().Get(1)); err != nil {
+			logrus.Errorf("Rename container %s error %v", containerName, err)
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	},
+}
+
+// docker update 修改容器的资源限制
+var updateCommand = cli.Command{
+	Name:  "update",
+	Usage: "update resource limits of one or more containers",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "memory, m",
+			Usage: "memory limit",
+		},
+		cli.StringFlag{
+			Name:  "cpu-shares",
+			Usage: "cpu shares (relative weight)",
+		},
+		cli.StringFlag{
+			Name:  "cpuset-cpus",
+			Usage: "cpus in which to allow execution (0-3, 0,1)",
+		},
+		cli.IntFlag{
+			Name:  "pids-limit",
+			Usage: "pids limit, 0 or -1 for unlimited",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("Missing container name")
+		}
+		update := &subsystems.ResourceConfig{
+			MemoryLimit: ctx.String("memory"),
+			CpuShare:    ctx.String("cpu-shares"),
+			CpuSet:      ctx.String("cpuset-cpus"),
+		}
+		if ctx.IsSet("pids-limit") {
+			update.PidsLimit = pidsLimit(ctx.Int("pids-limit"))
+		}
+		if *update == (subsystems.ResourceConfig{}) {
+			return fmt.Errorf("You must provide one or more flags when using this command")
+		}
+		failed := false
+		for _, containerName := range ctx.Args() {
+			if err := updateContainer(containerName, update); err != nil {
+				logrus.Errorf("Update container %s error %v", containerName, err)
+				failed = true
+				continue
+			}
+			fmt.Println(containerName)
+		}
+		if failed {
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	},
+}
+
+// docker unpause 恢复被暂停的容器
+var unpauseCommand = cli.Command{
+	Name:  "unpause",
+	Usage: "unpause all processes within a container",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("Missing container name")
+		}
+		containerName := ctx.Args().Get(0)
+		if err := unpauseContainer(containerName); err != nil {
+			logrus.Errorf("Unpause container %s error %v", containerName, err)
+			return cli.NewExitError("", 1)
+		}
 		return nil
 	},
 }
 
 var removeCommand = cli.Command{
-	Name:  "rm",
-	Usage: "remove unused containers",
+	Name:      "rm",
+	Usage:     "remove one or more containers",
+	ArgsUsage: "CONTAINER [CONTAINER...]",
+	// 支持 -fv 这样合并的短参数
+	UseShortOptionHandling: true,
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "force, f",
+			Usage: "force the removal of a running container (uses SIGKILL)",
+		},
+		cli.BoolFlag{
+			Name:  "volumes, v",
+			Usage: "remove anonymous volumes associated with the container",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("Missing container name")
+		}
+		// 逐个删除，有失败的容器时退出码为 1
+		failed := false
+		for _, containerName := range ctx.Args() {
+			if err := removeContainer(containerName, ctx.Bool("force"), ctx.Bool("volumes")); err != nil {
+				logrus.Errorf("Remove container %s error %v.", containerName, err)
+				failed = true
+				continue
+			}
+			fmt.Println(containerName)
+		}
+		if failed {
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	},
+}
+
+// docker diff 查看容器文件系统的变更
+var diffCommand = cli.Command{
+	Name:  "diff",
+	Usage: "inspect changes to files or directories on a container's filesystem",
+	Flags: []cli.Flag{
+		cli.BoolFlag{
+			Name:  "json",
+			Usage: "output changes as json",
+		},
+	},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 1 {
+			return fmt.Errorf("Missing container name")
+		}
+		containerName := ctx.Args().Get(0)
+		if err := diffContainer(containerName, ctx.Bool("json")); err != nil {
+			logrus.Errorf("Diff container %s error %v", containerName, err)
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	},
+}
+
+// docker cp 在宿主机与容器之间拷贝文件
+// copyDocker cp containerName:path hostPath
+// copyDocker cp hostPath containerName:path
+var copyCommand = cli.Command{
+	Name:  "cp",
+	Usage: "copy files/folders between a container and the local filesystem, use - to stream a tar archive",
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 2 {
+			return fmt.Errorf("Missing source or destination path")
+		}
+		if err := copyContainer(ctx.Args().Get(0), ctx.Args().Get(1)); err != nil {
+			logrus.Errorf("Copy error %v", err)
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	},
+}
+
+// docker export 导出容器的文件系统
+// copyDocker export containerName -o fs.tar
+var exportCommand = cli.Command{
+	Name:  "export",
+	Usage: "export a container's filesystem as a tar archive",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "o",
+			Usage: "write to a file, instead of STDOUT",
+		},
+	},
 	Action: func(ctx *cli.Context) error {
 		if len(ctx.Args()) < 1 {
 			return fmt.Errorf("Missing container name")
 		}
 		containerName := ctx.Args().Get(0)
-		removeContainer(containerName)
+		if err := exportContainer(containerName, ctx.String("o")); err != nil {
+			logrus.Errorf("Export container %s error %v", containerName, err)
+			return cli.NewExitError("", 1)
+		}
+		return nil
+	},
+}
+
+// docker import 将 tar 包导入为镜像
+// copyDocker import fs.tar name:tag
+var importCommand = cli.Command{
+	Name:  "import",
+	Usage: "import the contents from a tarball to create a filesystem image, use - to read from STDIN",
+	Flags: []cli.Flag{labelFlag},
+	Action: func(ctx *cli.Context) error {
+		if len(ctx.Args()) < 2 {
+			return fmt.Errorf("Missing tar file or image name")
+		}
+		imageName := ctx.Args().Get(1)
+		labels, err := parseLabels(ctx.StringSlice("label"), nil)
+		if err != nil {
+			return err
+		}
+		if err := importImage(ctx.Args().Get(0), imageName, labels); err != nil {
+			logrus.Errorf("Import image %s error %v", imageName, err)
+			return cli.NewExitError("", 1)
+		}
 		return nil
 	},
 }
+
+// 清理前需要确认，-f 跳过
+var forceFlag = cli.BoolFlag{
+	Name:  "force, f",
+	Usage: "do not prompt for confirmation",
+}
+
+// 只清理满足条件的对象，目前支持 label=key 与 label=key=value
+var pruneFilterFlag = cli.StringSliceFlag{
+	Name:  "filter",
+	Usage: "provide filter values (e.g. label=key=value)",
+}
+
+// commit 与 import 时设置镜像的标签
+var labelFlag = cli.StringSliceFlag{
+	Name:  "label",
+	Usage: "set metadata on the image (key=value)",
+}
+
+// docker container prune
+var containerCommand = cli.Command{
+	Name:  "container",
+	Usage: "manage containers",
+	Subcommands: []cli.Command{
+		{
+			Name:  "prune",
+			Usage: "remove all stopped containers",
+			Flags: []cli.Flag{forceFlag, pruneFilterFlag},
+			Action: func(ctx *cli.Context) error {
+				filters, err := ParseFilters(ctx.StringSlice("filter"), pruneFilterKeys)
+				if err != nil {
+					return err
+				}
+				if !ctx.Bool("force") && !confirmPrune("This will remove all stopped containers.") {
+					return nil
+				}
+				report, err := pruneContainers(filters)
+				if err != nil {
+					logrus.Errorf("Prune containers error %v", err)
+					return cli.NewExitError("", 1)
+				}
+				report.print("Containers")
+				fmt.Fprintf(os.Stdout, "Total reclaimed space: %s\n", humanSize(report.Reclaimed))
+				return nil
+			},
+		},
+	},
+}
+
+// docker image prune [--all]
+var imageCommand = cli.Command{
+	Name:  "image",
+	Usage: "manage images",
+	Subcommands: []cli.Command{
+		{
+			Name:  "prune",
+			Usage: "remove unused extracted image layers, with --all remove unused images too",
+			Flags: []cli.Flag{
+				forceFlag,
+				pruneFilterFlag,
+				cli.BoolFlag{
+					Name:  "all, a",
+					Usage: "remove all images not used by any container",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				filters, err := ParseFilters(ctx.StringSlice("filter"), pruneFilterKeys)
+				if err != nil {
+					return err
+				}
+				all := ctx.Bool("all")
+				warning := "This will remove all extracted layers of images not used by any container."
+				if all {
+					warning = "This will remove all images not used by any container."
+				}
+				if !ctx.Bool("force") && !confirmPrune(warning) {
+					return nil
+				}
+				report, err := pruneImages(all, filters)
+				if err != nil {
+					logrus.Errorf("Prune images error %v", err)
+					return cli.NewExitError("", 1)
+				}
+				report.print("Images")
+				fmt.Fprintf(os.Stdout, "Total reclaimed space: %s\n", humanSize(report.Reclaimed))
+				return nil
+			},
+		},
+	},
+}
+
+// docker system prune 与 docker system df
+var systemCommand = cli.Command{
+	Name:  "system",
+	Usage: "manage copyDocker",
+	Subcommands: []cli.Command{
+		{
+			Name:  "prune",
+			Usage: "remove stopped containers, leftover workspaces, unused image layers and orphaned cgroups",
+			Flags: []cli.Flag{
+				forceFlag,
+				pruneFilterFlag,
+				cli.BoolFlag{
+					Name:  "all, a",
+					Usage: "remove all images not used by any container",
+				},
+			},
+			Action: func(ctx *cli.Context) error {
+				filters, err := ParseFilters(ctx.StringSlice("filter"), pruneFilterKeys)
+				if err != nil {
+					return err
+				}
+				if !ctx.Bool("force") && !confirmPrune("This will remove all stopped containers, "+
+					"leftover workspaces, unused images and orphaned cgroups.") {
+					return nil
+				}
+				var reclaimed int64
+				failed := false
+				// 工作空间与 cgroup 没有标签，指定了过滤条件时不清理
+				steps := []struct {
+					title      string
+					filterable bool
+					prune      func() (*pruneReport, error)
+				}{
+					{"Containers", true, func() (*pruneReport, error) { return pruneContainers(filters) }},
+					{"Workspaces", false, pruneWorkSpaces},
+					{"Images", true, func() (*pruneReport, error) { return pruneImages(ctx.Bool("all"), filters) }},
+					{"Cgroups", false, pruneCgroups},
+				}
+				for _, step := range steps {
+					if len(filters) > 0 && !step.filterable {
+						continue
+					}
+					report, err := step.prune()
+					if err != nil {
+						logrus.Errorf("Prune %s error %v", step.title, err)
+						failed = true
+						continue
+					}
+					report.print(step.title)
+					reclaimed += report.Reclaimed
+				}
+				fmt.Fprintf(os.Stdout, "Total reclaimed space: %s\n", humanSize(reclaimed))
+				// 其余的步骤照常执行，但以非零退出码报告失败
+				if failed {
+					return cli.NewExitError("", 1)
+				}
+				return nil
+			},
+		},
+		{
+			Name:  "df",
+			Usage: "show copyDocker disk usage",
+			Action: func(ctx *cli.Context) error {
+				usages, err := systemDiskUsage()
+				if err != nil {
+					logrus.Errorf("System df error %v", err)
+					return cli.NewExitError("", 1)
+				}
+				printDiskUsage(usages)
+				return nil
+			},
+		},
+		{
+			Name:  "migrate",
+			Usage: "move data of an older version from /root and /var/run/copyDocker to --root, all containers must be stopped",
+			Action: func(ctx *cli.Context) error {
+				moved, err := migrateLegacyLayout()
+				for _, m := range moved {
+					fmt.Fprintln(os.Stdout, m)
+				}
+				if err != nil {
+					logrus.Errorf("Migrate error %v", err)
+					return cli.NewExitError("", 1)
+				}
+				// 迁移过来的容器信息仍是之前版本的格式
+				if err := state.Migrate(); err != nil {
+					logrus.Errorf("Migrate containers error %v", err)
+					return cli.NewExitError("", 1)
+				}
+				return nil
+			},
+		},
+	},
+}
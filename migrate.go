@@ -0,0 +1,162 @@
+package main
+
+import (
+	"copyDocker/container"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 11:05 2022/3/31
+ @Description: 将之前版本在 /root 与 /var/run/copyDocker 下的数据迁移到新的目录布局
+*/
+
+// 之前版本的可写层与挂载点
+var (
+	legacyWriteLayerURL = filepath.Join(container.LegacyRootURL, "writeLayer")
+	legacyMntURL        = filepath.Join(container.LegacyRootURL, "mnt")
+	legacyNetworkURL    = filepath.Join(container.LegacyInfoLocation, "network")
+)
+
+// 读取之前版本的容器信息，key 为容器信息所在的目录名
+func legacyContainers() (map[string]*container.ContainerInfo, error) {
+	files, err := ioutil.ReadDir(container.LegacyInfoLocation)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	containers := map[string]*container.ContainerInfo{}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		content, err := ioutil.ReadFile(filepath.Join(container.LegacyInfoLocation, f.Name(), container.ConfigName))
+		if err != nil {
+			continue
+		}
+		var info container.ContainerInfo
+		if err := json.Unmarshal(content, &info); err != nil {
+			logrus.Warnf("Unmarshal legacy container %s error %v", f.Name(), err)
+			continue
+		}
+		containers[f.Name()] = &info
+	}
+	return containers, nil
+}
+
+// 使用默认目录时，发现之前版本的数据则提示迁移
+func warnLegacyLayout() {
+	if container.RootDir != container.DefaultRootDir {
+		return
+	}
+	containers, err := legacyContainers()
+	if err != nil || len(containers) == 0 {
+		return
+	}
+	logrus.Warnf("Found %d containers of an older version under %s, run 'copyDocker system migrate' to move them to %s",
+		len(containers), container.LegacyInfoLocation, container.RootDir)
+}
+
+// 迁移之前版本的容器、镜像与网络配置，返回迁移的路径
+// 迁移前需要停止所有容器：运行中容器的文件系统挂载在旧的挂载点上，且 aufs 的挂载参数中包含旧的可写层路径
+func migrateLegacyLayout() ([]string, error) {
+	containers, err := legacyContainers()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range containers {
+		if info.IsAlive() || info.MonitorAlive() {
+			return nil, fmt.Errorf("container %s is still running, stop all containers before migrating", info.Name)
+		}
+	}
+
+	var moved []string
+	move := func(src, dst string) error {
+		if exist, _ := container.PathExists(src); !exist {
+			return nil
+		}
+		if err := moveDir(src, dst); err != nil {
+			return err
+		}
+		moved = append(moved, src+" -> "+dst)
+		return nil
+	}
+
+	for dirName, info := range containers {
+		// 卸载旧的挂载点，新的挂载点在 start 时创建，非空时说明卸载不完整，保留不动
+		mntURL := filepath.Join(legacyMntURL, info.Name)
+		if err := container.UnmountAll(mntURL); err != nil {
+			return moved, fmt.Errorf("umount %s error %v", mntURL, err)
+		}
+		if err := os.Remove(mntURL); err != nil && !os.IsNotExist(err) {
+			logrus.Warnf("Remove legacy mount point %s error %v", mntURL, err)
+		}
+		if err := move(filepath.Join(legacyWriteLayerURL, info.Name), fmt.Sprintf(container.WriteLayerUrl, info.ID)); err != nil {
+			return moved, err
+		}
+		if err := move(filepath.Join(container.LegacyInfoLocation, dirName), filepath.Clean(fmt.Sprintf(container.DefaultInfoLocation, info.ID))); err != nil {
+			return moved, err
+		}
+		if err := reserveContainerName(info.Name, info.ID); err != nil {
+			logrus.Warnf("Reserve name of container %s error %v", info.ID, err)
+		}
+	}
+	// 名字的对应关系已经在新的目录下重建
+	os.RemoveAll(filepath.Join(container.LegacyInfoLocation, ".names"))
+
+	// 镜像文件、镜像元数据与解压出的只读层
+	files, err := ioutil.ReadDir(container.LegacyRootURL)
+	if err != nil && !os.IsNotExist(err) {
+		return moved, err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".tar") {
+			continue
+		}
+		storeName := strings.TrimSuffix(f.Name(), ".tar")
+		for _, name := range []string{f.Name(), storeName + ".json", storeName} {
+			if err := move(filepath.Join(container.LegacyRootURL, name), filepath.Join(container.ImageStoreURL, name)); err != nil {
+				return moved, err
+			}
+		}
+	}
+
+	if err := move(legacyNetworkURL, filepath.Join(container.RootDir, "network")); err != nil {
+		return moved, err
+	}
+	// 只删除已经清空的旧目录
+	os.Remove(legacyWriteLayerURL)
+	os.Remove(legacyMntURL)
+	return moved, nil
+}
+
+// 移动目录或文件，目标已存在时报错，跨文件系统时先拷贝再删除
+func moveDir(src, dst string) error {
+	if exist, _ := container.PathExists(dst); exist {
+		return fmt.Errorf("move %s error: %s already exists", src, dst)
+	}
+	if err := os.MkdirAll(filepath.Dir(dst), 0755); err != nil {
+		return err
+	}
+	err := os.Rename(src, dst)
+	if err == nil {
+		return nil
+	}
+	if linkErr, ok := err.(*os.LinkError); !ok || linkErr.Err != syscall.EXDEV {
+		return err
+	}
+	if err := copyPath(src, filepath.Dir(dst), filepath.Base(dst)); err != nil {
+		os.RemoveAll(dst)
+		return fmt.Errorf("copy %s to %s error %v", src, dst, err)
+	}
+	return os.RemoveAll(src)
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"copyDocker/container"
+	"copyDocker/state"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 17:40 2022/3/28
+ @Description: 后台容器的 monitor 进程，负责持有容器的输出、等待容器退出并记录状态、清理 cgroup
+*/
+
+// 标识当前进程为 monitor 的环境变量
+const ENV_MONITOR = "copyDocker_monitor"
+
+// monitor 日志文件
+const monitorLogFile = "monitor.log"
+
+// 重启的退避时间，从 restartBackoffMin 开始翻倍，最长为 restartBackoffMax
+// 容器运行超过 restartBackoffReset 后退出，退避时间重新计算
+const (
+	restartBackoffMin   = 100 * time.Millisecond
+	restartBackoffMax   = time.Minute
+	restartBackoffReset = 10 * time.Second
+)
+
+// monitor 中向 run 命令报告启动结果的管道，fd 3
+var monitorPipe *os.File
+
+// monitor 的日志文件
+var monitorLog *os.File
+
+// monitor 收到的 SIGTERM，start、restart 与 stop 以此通知等待重启的 monitor 放弃重启
+// monitor 不会因为 SIGTERM 退出，容器运行期间收到的信号会让之后的重启直接放弃
+var monitorStop = make(chan os.Signal, 1)
+
+// 以 monitor 的方式启动后台容器
+// 重新执行当前的 run 命令，新的进程脱离终端成为 monitor，由它创建容器并等待其退出
+// 当前进程只等待 monitor 报告容器是否启动成功
+func startMonitor() error {
+	readPipe, writePipe, err := os.Pipe()
+	if err != nil {
+		return fmt.Errorf("new pipe error %v", err)
+	}
+	defer readPipe.Close()
+
+	cmd := exec.Command("/proc/self/exe", os.Args[1:]...)
+	cmd.Env = append(os.Environ(), ENV_MONITOR+"=1")
+	cmd.ExtraFiles = []*os.File{writePipe}
+	// 新的会话，不受终端关闭的影响
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setsid: true}
+	if err := cmd.Start(); err != nil {
+		writePipe.Close()
+		return fmt.Errorf("start monitor error %v", err)
+	}
+	writePipe.Close()
+
+	var msg container.SyncMessage
+	if err := json.NewDecoder(readPipe).Decode(&msg); err != nil {
+		cmd.Wait()
+		if err == io.EOF {
+			return fmt.Errorf("monitor exited before the container started")
+		}
+		return fmt.Errorf("read monitor pipe error %v", err)
+	}
+	if msg.Type == container.SyncError {
+		cmd.Wait()
+		return fmt.Errorf("%s", msg.Message)
+	}
+	// 输出容器 ID，monitor 继续在后台运行
+	fmt.Println(msg.Message)
+	return cmd.Process.Release()
+}
+
+// 当前进程是否为 monitor，是则取出报告管道，并清除环境变量以免传入容器
+func initMonitor() bool {
+	if os.Getenv(ENV_MONITOR) == "" {
+		return false
+	}
+	os.Unsetenv(ENV_MONITOR)
+	monitorPipe = os.NewFile(uintptr(3), "monitor")
+	syscall.CloseOnExec(3)
+	signal.Notify(monitorStop, syscall.SIGTERM)
+	return true
+}
+
+// monitor 向 run 命令报告启动结果，只报告一次
+func notifyMonitorParent(msg container.SyncMessage) {
+	if monitorPipe == nil {
+		return
+	}
+	if err := json.NewEncoder(monitorPipe).Encode(msg); err != nil {
+		logrus.Errorf("Write monitor pipe error %v", err)
+	}
+	monitorPipe.Close()
+	monitorPipe = nil
+}
+
+// 容器启动后 monitor 的标准输出已经无人读取，将日志写入容器目录下的 monitor.log
+// 一个 monitor 只负责一个容器，重启容器时沿用已经打开的日志文件
+func redirectMonitorLog(containerID string) {
+	if monitorLog != nil {
+		return
+	}
+	logPath := fmt.Sprintf(container.DefaultInfoLocation, containerID) + monitorLogFile
+	file, err := os.OpenFile(logPath, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0622)
+	if err != nil {
+		logrus.Errorf("Open monitor log %s error %v", logPath, err)
+		return
+	}
+	logrus.SetOutput(file)
+	monitorLog = file
+}
+
+// monitor 在容器退出后按照重启策略重新启动容器，直到不再需要重启
+func superviseContainer(containerID string) {
+	backoff := restartBackoffMin
+	for {
+		info, err := state.Load(containerID)
+		if err != nil || !info.ShouldRestart() {
+			return
+		}
+		if time.Since(info.StartedAt) >= restartBackoffReset {
+			backoff = restartBackoffMin
+		}
+		err = state.Update(containerID, func(info *container.ContainerInfo) error {
+			info.Status = container.RESTARTING
+			return nil
+		})
+		if err != nil {
+			logrus.Errorf("Save container %s info error %v", info.Name, err)
+		}
+		logrus.Infof("Restart container %s in %v", info.Name, backoff)
+		select {
+		case <-time.After(backoff):
+		case <-monitorStop:
+			logrus.Infof("Give up restarting container %s", info.Name)
+			abandonRestart(containerID)
+			return
+		}
+		if backoff *= 2; backoff > restartBackoffMax {
+			backoff = restartBackoffMax
+		}
+
+		// 等待期间容器可能被 stop 或删除
+		if info, err = state.Load(containerID); err != nil {
+			return
+		}
+		if !info.ShouldRestart() {
+			abandonRestart(containerID)
+			return
+		}
+		info.RestartCount++
+		if _, err := runContainer(info, false, false); err != nil {
+			logrus.Errorf("Restart container %s error %v", info.Name, err)
+			markStartFailed(containerID, info.RestartCount)
+		}
+	}
+}
+
+// 重启失败也算作一次失败的运行，记录为以 runErrorExitCode 退出，on-failure:N 据此停止重试
+func markStartFailed(containerID string, restartCount int) {
+	err := state.Update(containerID, func(info *container.ContainerInfo) error {
+		info.Status = container.Exit
+		info.Pid = ""
+		info.ExitCode = runErrorExitCode
+		info.RestartCount = restartCount
+		info.FinishedAt = time.Now()
+		return nil
+	})
+	if err != nil && !os.IsNotExist(err) {
+		logrus.Errorf("Save container %s info error %v", containerID, err)
+	}
+}
+
+// 放弃重启，等待重启的容器改为 exited
+func abandonRestart(containerID string) {
+	state.Update(containerID, func(info *container.ContainerInfo) error {
+		if info.Status == container.RESTARTING {
+			info.Status = container.Exit
+		}
+		return nil
+	})
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"copyDocker/cgroups/subsystems"
+	"copyDocker/container"
+	"copyDocker/internal/testutil"
+	"copyDocker/state"
+	"testing"
+	"time"
+)
+
+// 重启时启动失败（镜像不存在）也计入重启次数，on-failure:N 达到上限后不再重试
+func TestSuperviseFailedStart(t *testing.T) {
+	testutil.SetupRoot(t)
+	info := &container.ContainerInfo{
+		ID:            "0123456789",
+		Name:          "supervise-test",
+		Image:         "copydocker-test-no-such-image",
+		Status:        container.Exit,
+		ExitCode:      1,
+		RestartPolicy: container.RestartPolicy{Name: container.RestartOnFailure, MaximumRetryCount: 2},
+		Resource:      &subsystems.ResourceConfig{},
+		Config:        &container.InitConfig{Args: []string{"sh"}},
+	}
+	if err := state.Create(info.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Save(info); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		superviseContainer(info.ID)
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("superviseContainer keeps restarting a container that can not start")
+	}
+
+	got, err := state.Load(info.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != container.Exit || got.ExitCode != runErrorExitCode || got.RestartCount != 2 {
+		t.Errorf("status = %s, exit code = %d, restart count = %d, want %s, %d, 2",
+			got.Status, got.ExitCode, got.RestartCount, container.Exit, runErrorExitCode)
+	}
+}
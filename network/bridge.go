@@ -19,7 +19,7 @@ type BridgeNetworkDriver struct {
 }
 
 func (b BridgeNetworkDriver) Name() string {
-	panic("implement me")
+	return "bridge"
 }
 
 func (b *BridgeNetworkDriver) Create(subnet string, name string) (*NetWork, error) {
@@ -83,8 +83,18 @@ func (b *BridgeNetworkDriver) Connect(network *NetWork, endpoint *Endpoint) erro
 	return nil
 }
 
+// Disconnect 删除宿主机一端的 veth 设备，另一端随之删除
 func (b *BridgeNetworkDriver) Disconnect(network NetWork, endpoint *Endpoint) error {
-	panic("implement me")
+	link, err := netlink.LinkByName(endpoint.Device.Name)
+	if err != nil {
+		// 容器的 network namespace 销毁时 veth 设备已经被删除
+		if _, ok := err.(netlink.LinkNotFoundError); ok {
+			return nil
+		}
+		return err
+	}
+	// ip link del xxx
+	return netlink.LinkDel(link)
 }
 
 // 1. 创建 Bridge 虚拟设备
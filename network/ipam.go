@@ -1,6 +1,7 @@
 package network
 
 import (
+	"copyDocker/container"
 	"encoding/json"
 	"github.com/sirupsen/logrus"
 	"net"
@@ -15,7 +16,7 @@ import (
  @Description: 实现给容器网段的分配，不会造成重复
 */
 
-const ipamDefaultAllocatorPath = "/var/run/copyDocker/network/ipam/subnet.json"
+var ipamDefaultAllocatorPath = path.Join(container.DefaultRootDir, "network", "ipam", "subnet.json")
 
 // IPAM 存放 IP 地址分配信息
 type IPAM struct {
@@ -26,7 +27,7 @@ type IPAM struct {
 }
 
 // 使用默认路径作为分配信息存储位置
-var ipAllocator = &IPAM{SubnetAllocatorPath: defaultNetworkPath}
+var ipAllocator = &IPAM{SubnetAllocatorPath: ipamDefaultAllocatorPath}
 
 // Allocate 实现地址的分配
 func (i *IPAM) Allocate(subnet *net.IPNet) (ip net.IP, err error) {
@@ -23,11 +23,17 @@ import (
 )
 
 var (
-	defaultNetworkPath = "/var/run/copyDocker/network/network"
+	defaultNetworkPath = path.Join(container.DefaultRootDir, "network", "network")
 	drivers            = map[string]NetworkDriver{}
 	networks           = map[string]*NetWork{}
 )
 
+// SetRoot 网络与地址分配的配置存储在 ${root}/network 下
+func SetRoot(root string) {
+	defaultNetworkPath = path.Join(root, "network", "network")
+	ipAllocator.SubnetAllocatorPath = path.Join(root, "network", "ipam", "subnet.json")
+}
+
 // NetWork 网络
 // 一个集合，这个网络上的容器可以互相通信
 // 可以直接通过 Bridge 设备实现网络互连
@@ -65,24 +71,20 @@ func Init() error {
 	bridgeDrive := &BridgeNetworkDriver{}
 	drivers[bridgeDrive.Name()] = bridgeDrive
 	// 判断网络的配置目录是否存在
-	if _, err := os.Stat(defaultNetworkPath); err != nil {
-		if os.IsNotExist(err) {
-			os.Create(defaultNetworkPath)
-		} else {
-			return err
-		}
+	if err := os.MkdirAll(defaultNetworkPath, 0755); err != nil {
+		return err
 	}
 
 	// 检查网络配置目录中的所有文件
 	filepath.Walk(defaultNetworkPath, func(nwPath string, info os.FileInfo, err error) error {
-		if info.IsDir() {
+		if err != nil || info.IsDir() {
 			return nil
 		}
 		// 文件名即为网络名
 		_, nwName := path.Split(nwPath)
 		nw := &NetWork{Name: nwName}
 		if err := nw.load(nwPath); err != nil {
-			logrus.Errorf("path %s load network error", nwPath, err)
+			logrus.Errorf("path %s load network error %v", nwPath, err)
 		}
 		networks[nwName] = nw
 		return nil
@@ -146,13 +148,26 @@ func DeleteNetwork(networkName string) error {
 	return nw.remove(defaultNetworkPath)
 }
 
+// GetNetwork 从网络配置目录中读取指定的网络
+func GetNetwork(networkName string) (*NetWork, error) {
+	nwPath := path.Join(defaultNetworkPath, networkName)
+	if _, err := os.Stat(nwPath); err != nil {
+		return nil, err
+	}
+	nw := &NetWork{Name: networkName}
+	if err := nw.load(nwPath); err != nil {
+		return nil, err
+	}
+	return nw, nil
+}
+
 // 将网络配置信息存储在文件系统中，以便于网络查询及在这个网络上连接网络端点
 func (nw *NetWork) dump(dumpPath string) error {
 	// 首先检查目录是否存在，不在就创建
 	if _, err := os.Stat(dumpPath); err != nil {
 		if os.IsNotExist(err) {
 			// 不存在，创建
-			os.MkdirAll(dumpPath, 0644)
+			os.MkdirAll(dumpPath, 0755)
 		} else {
 			return err
 		}
@@ -162,7 +177,7 @@ func (nw *NetWork) dump(dumpPath string) error {
 	// 打开保证为空，只写，不存在就创建
 	nwFile, err := os.OpenFile(nwPath, os.O_WRONLY|os.O_TRUNC|os.O_CREATE, 0644)
 	if err != nil {
-		logrus.Errorf("error:", err)
+		logrus.Errorf("error: %v", err)
 		return err
 	}
 	defer nwFile.Close()
@@ -170,13 +185,13 @@ func (nw *NetWork) dump(dumpPath string) error {
 	// 跟前面一样，json序列化存储
 	nwJson, err := json.Marshal(nw)
 	if err != nil {
-		logrus.Errorf("Json nw error:", err)
+		logrus.Errorf("Json nw error: %v", err)
 		return err
 	}
 
 	_, err = nwFile.Write(nwJson)
 	if err != nil {
-		logrus.Errorf("error:", err)
+		logrus.Errorf("error: %v", err)
 		return err
 	}
 	return nil
@@ -244,7 +259,51 @@ func Connect(networkName string, cinfo *container.ContainerInfo) error {
 		return err
 	}
 	// 配置容器到宿主机的端口映射 , 如 -p 80:80
-	return configPortMapping(ep, cinfo)
+	if err = configPortMapping(ep, cinfo); err != nil {
+		return err
+	}
+	// 记录在容器信息中，删除容器时据此清理
+	cinfo.Endpoints = append(cinfo.Endpoints, container.Endpoint{
+		ID:          ep.ID,
+		Network:     networkName,
+		Device:      ep.Device.Name,
+		IPAddress:   ep.IPAddress.String(),
+		PortMapping: ep.PortMapping,
+	})
+	return nil
+}
+
+// Disconnect 删除容器的网络端点：端口映射、veth 设备，并释放 IP
+// 容器的 network namespace 销毁时 veth 设备随之删除，此时只需清理端口映射与 IP
+func Disconnect(ep container.Endpoint) error {
+	network, ok := networks[ep.Network]
+	// 网络已经被删除，veth 设备随网桥删除，地址分配也已失效
+	if !ok {
+		return nil
+	}
+	// 驱动不存在时不做任何清理，避免只删除了一半
+	driver, ok := drivers[network.Driver]
+	if !ok {
+		return fmt.Errorf("unknown driver %s of network %s", network.Driver, ep.Network)
+	}
+	ip := net.ParseIP(ep.IPAddress)
+	if ip == nil {
+		return fmt.Errorf("invalid ip %s of endpoint %s", ep.IPAddress, ep.ID)
+	}
+	endpoint := &Endpoint{
+		ID:          ep.ID,
+		Device:      netlink.Veth{LinkAttrs: netlink.LinkAttrs{Name: ep.Device}},
+		IPAddress:   ip,
+		Network:     network,
+		PortMapping: ep.PortMapping,
+	}
+	if err := deletePortMapping(endpoint); err != nil {
+		return err
+	}
+	if err := driver.Disconnect(*network, endpoint); err != nil {
+		return err
+	}
+	return ipAllocator.Release(network.IpRange, &ip)
 }
 
 // 配置容器网络端点的地址和路由
@@ -333,6 +392,23 @@ func configPortMapping(ep *Endpoint, cinfo *container.ContainerInfo) error {
 	return nil
 }
 
+// 删除 configPortMapping 添加的端口映射规则
+func deletePortMapping(ep *Endpoint) error {
+	for _, pm := range ep.PortMapping {
+		portMapping := strings.Split(pm, ":")
+		if len(portMapping) != 2 {
+			continue
+		}
+		iptablesCmd := fmt.Sprintf("-t nat -D PREROUTING -p tcp -m tcp --dport %s -j DNAT --to-destination %s:%s",
+			portMapping[0], ep.IPAddress.String(), portMapping[1])
+		output, err := exec.Command("iptables", strings.Split(iptablesCmd, " ")...).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("delete port mapping %s error %v: %s", pm, err, output)
+		}
+	}
+	return nil
+}
+
 // 1. 将容器的网络端点加入到容器的网络空间中
 // 2. 锁定当前程序所执行的线程，使当前线程进入到容器的网络空间
 // 3. 返回一个函数指针，并执行这个函数，退出容器的网络空间
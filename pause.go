@@ -0,0 +1,72 @@
+package main
+
+import (
+	"copyDocker/cgroups"
+	"copyDocker/container"
+	"copyDocker/state"
+	"fmt"
+	"github.com/sirupsen/logrus"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 14:50 2022/3/29
+ @Description: docker pause、unpause 的实现，通过 freezer cgroup 暂停容器中的所有进程
+*/
+
+// 暂停容器
+func pauseContainer(containerName string) error {
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if info.Status == container.PAUSED {
+		return fmt.Errorf("container %s is already paused", containerName)
+	}
+	if info.Status != container.RUNNING || !info.IsAlive() {
+		return fmt.Errorf("container %s is not running", containerName)
+	}
+	if err := cgroups.NewCgroupManager(cgroups.ContainerPath(info.ID)).Freeze(); err != nil {
+		return err
+	}
+	return setContainerStatus(info, container.PAUSED)
+}
+
+// 恢复被暂停的容器
+func unpauseContainer(containerName string) error {
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if info.Status != container.PAUSED {
+		return fmt.Errorf("container %s is not paused", containerName)
+	}
+	return thawContainer(info)
+}
+
+// 恢复暂停的容器并更新状态
+func thawContainer(info *container.ContainerInfo) error {
+	if err := cgroups.NewCgroupManager(cgroups.ContainerPath(info.ID)).Thaw(); err != nil {
+		return err
+	}
+	return setContainerStatus(info, container.RUNNING)
+}
+
+// 更新容器的状态，同时更新 info
+func setContainerStatus(info *container.ContainerInfo, status string) error {
+	info.Status = status
+	return state.Update(info.ID, func(info *container.ContainerInfo) error {
+		info.Status = status
+		return nil
+	})
+}
+
+// 被暂停的进程收不到信号，发送信号之后恢复，使其能够退出
+func thawIfPaused(info *container.ContainerInfo) {
+	if info.Status != container.PAUSED {
+		return
+	}
+	if err := thawContainer(info); err != nil {
+		logrus.Errorf("Unpause container %s error %v", info.Name, err)
+	}
+}
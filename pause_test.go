@@ -0,0 +1,87 @@
+package main
+
+import (
+	"copyDocker/container"
+	"copyDocker/internal/testutil"
+	"copyDocker/state"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestPauseStateChecks(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  string
+		alive   bool
+		pause   bool
+		wantErr string
+	}{
+		{name: "pause paused", status: container.PAUSED, alive: true, pause: true, wantErr: "already paused"},
+		{name: "pause exited", status: container.Exit, pause: true, wantErr: "not running"},
+		{name: "unpause running", status: container.RUNNING, alive: true, wantErr: "not paused"},
+		{name: "unpause exited", status: container.Exit, wantErr: "not paused"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.SetupRoot(t)
+			info := &container.ContainerInfo{ID: "0123456789", Name: "pause-test", Status: tt.status}
+			// 以测试进程作为存活的 init 进程
+			if tt.alive {
+				info.Pid = strconv.Itoa(os.Getpid())
+				info.PidStartTime, _ = container.ProcessStartTime(info.Pid)
+			}
+			if err := state.Create(info.ID); err != nil {
+				t.Fatal(err)
+			}
+			if err := state.Save(info); err != nil {
+				t.Fatal(err)
+			}
+
+			var err error
+			if tt.pause {
+				err = pauseContainer(info.Name)
+			} else {
+				err = unpauseContainer(info.Name)
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("error = %v, want %q", err, tt.wantErr)
+			}
+			// 检查失败时不修改容器状态
+			got, err := state.Load(info.ID)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got.Status != tt.status {
+				t.Errorf("status = %s, want %s", got.Status, tt.status)
+			}
+		})
+	}
+}
+
+func TestSetContainerStatus(t *testing.T) {
+	testutil.SetupRoot(t)
+	info := &container.ContainerInfo{ID: "0123456789", Name: "pause-test", Status: container.RUNNING, Image: "busybox"}
+	info.Pid = strconv.Itoa(os.Getpid())
+	info.PidStartTime, _ = container.ProcessStartTime(info.Pid)
+	if err := state.Create(info.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Save(info); err != nil {
+		t.Fatal(err)
+	}
+	if err := setContainerStatus(info, container.PAUSED); err != nil {
+		t.Fatal(err)
+	}
+	if info.Status != container.PAUSED {
+		t.Errorf("info status = %s, want %s", info.Status, container.PAUSED)
+	}
+	got, err := state.Load(info.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != container.PAUSED || got.Image != "busybox" {
+		t.Errorf("saved status = %s, image = %s, want %s, busybox", got.Status, got.Image, container.PAUSED)
+	}
+}
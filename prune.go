@@ -0,0 +1,419 @@
+package main
+
+import (
+	"copyDocker/cgroups"
+	"copyDocker/container"
+	"copyDocker/state"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 21:02 2022/3/26
+ @Description: docker container/image/system prune 与 system df 的实现
+*/
+
+// 一次清理的结果
+type pruneReport struct {
+	Deleted   []string // 删除的对象
+	Reclaimed int64    // 释放的空间
+}
+
+func (r *pruneReport) add(name string, size int64) {
+	r.Deleted = append(r.Deleted, name)
+	r.Reclaimed += size
+}
+
+func (r *pruneReport) print(title string) {
+	if len(r.Deleted) > 0 {
+		fmt.Fprintf(os.Stdout, "Deleted %s:\n", title)
+		for _, name := range r.Deleted {
+			fmt.Fprintln(os.Stdout, name)
+		}
+		fmt.Fprintln(os.Stdout)
+	}
+}
+
+// 磁盘占用的统计项
+type diskUsage struct {
+	Type        string
+	Total       int
+	Active      int
+	Size        int64
+	Reclaimable int64
+}
+
+// prune 支持的过滤条件
+var pruneFilterKeys = map[string]bool{"label": true}
+
+// 清理所有未运行且满足过滤条件的容器
+func pruneContainers(filters map[string][]string) (*pruneReport, error) {
+	containers, err := state.List()
+	if err != nil {
+		return nil, err
+	}
+	report := &pruneReport{}
+	for _, info := range containers {
+		if info.IsRunning() || !matchContainerFilters(info, filters) {
+			continue
+		}
+		size := containerSize(info)
+		if err := deleteContainer(info, false); err != nil {
+			logrus.Errorf("Remove container %s error %v", info.Name, err)
+			continue
+		}
+		report.add(info.ID, size)
+	}
+	return report, nil
+}
+
+// 清理崩溃后残留的 ${state}/mnt/${} 与 ${root}/writeLayer/${}，即没有对应容器信息的工作空间
+func pruneWorkSpaces() (*pruneReport, error) {
+	keys, err := workSpaceKeys()
+	if err != nil {
+		return nil, err
+	}
+	report := &pruneReport{}
+	for _, name := range orphanDirs(container.MntURL, keys) {
+		mntURL := fmt.Sprintf(container.MntURL, name)
+		// 先卸载，避免删除到数据卷中的内容
+		if err := container.UnmountAll(mntURL); err != nil {
+			logrus.Errorf("Umount %s error %v", mntURL, err)
+			continue
+		}
+		if err := os.RemoveAll(mntURL); err != nil {
+			logrus.Errorf("Remove %s error %v", mntURL, err)
+			continue
+		}
+		report.add(mntURL, 0)
+	}
+	for _, name := range orphanDirs(container.WriteLayerUrl, keys) {
+		writeURL := fmt.Sprintf(container.WriteLayerUrl, name)
+		size := dirSize(writeURL)
+		if err := os.RemoveAll(writeURL); err != nil {
+			logrus.Errorf("Remove %s error %v", writeURL, err)
+			continue
+		}
+		report.add(writeURL, size)
+	}
+	return report, nil
+}
+
+// 清理未被容器使用的镜像
+// 默认只删除解压出的只读层，下次 run 时会重新解压；all 为 true 时连同镜像文件与元数据一起删除
+// 指定了过滤条件时只清理标签满足条件的镜像
+func pruneImages(all bool, filters map[string][]string) (*pruneReport, error) {
+	// 等待正在启动的容器记录使用的镜像
+	unlock, err := container.LockImages(true)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	used, err := usedImages()
+	if err != nil {
+		return nil, err
+	}
+	files, err := ioutil.ReadDir(container.ImageStoreURL)
+	if err != nil {
+		return nil, err
+	}
+	report := &pruneReport{}
+	for _, f := range files {
+		p := filepath.Join(container.ImageStoreURL, f.Name())
+		// 解压、导入、提交失败后残留的临时文件
+		if isTempImageFile(f.Name()) {
+			size := dirSize(p)
+			if err := os.RemoveAll(p); err != nil {
+				logrus.Errorf("Remove %s error %v", p, err)
+				continue
+			}
+			report.add(p, size)
+			continue
+		}
+		if !strings.HasSuffix(f.Name(), ".tar") || f.IsDir() {
+			continue
+		}
+		storeName := strings.TrimSuffix(f.Name(), ".tar")
+		if used[storeName] || !matchImageFilters(storeName, filters) {
+			continue
+		}
+		layerURL := filepath.Join(container.ImageStoreURL, storeName)
+		if exist, _ := container.PathExists(layerURL); exist {
+			size := dirSize(layerURL)
+			if err := os.RemoveAll(layerURL); err != nil {
+				logrus.Errorf("Remove %s error %v", layerURL, err)
+				continue
+			}
+			report.add(layerURL, size)
+		}
+		if all {
+			if err := os.Remove(p); err != nil {
+				logrus.Errorf("Remove %s error %v", p, err)
+				continue
+			}
+			report.add(p, f.Size())
+			configURL := container.ImageConfigURL(storeName)
+			if err := os.Remove(configURL); err != nil && !os.IsNotExist(err) {
+				logrus.Errorf("Remove %s error %v", configURL, err)
+			}
+		}
+	}
+	return report, nil
+}
+
+// 判断镜像的标签是否满足过滤条件，同一个 key 的多个值之间为或
+func matchImageFilters(storeName string, filters map[string][]string) bool {
+	values := filters["label"]
+	if len(values) == 0 {
+		return true
+	}
+	labels := imageLabels(storeName)
+	for _, value := range values {
+		if matchLabel(labels, value) {
+			return true
+		}
+	}
+	return false
+}
+
+// 清理 copyDocker 下没有对应容器的 cgroup，根节点下其它程序创建的 cgroup 不会被清理
+func pruneCgroups() (*pruneReport, error) {
+	// 正在启动的容器还没有 config.json，但已经创建了 cgroup
+	ids, err := state.IDs()
+	if err != nil {
+		return nil, err
+	}
+	report := &pruneReport{}
+	for _, cgroupPath := range cgroups.ListCgroups(isContainerID) {
+		if ids[path.Base(cgroupPath)] {
+			continue
+		}
+		if err := cgroups.NewCgroupManager(cgroupPath).Destroy(); err != nil {
+			logrus.Errorf("Remove cgroup %s error %v", cgroupPath, err)
+			continue
+		}
+		report.add(cgroupPath, 0)
+	}
+	return report, nil
+}
+
+// 统计各类数据的磁盘占用
+func systemDiskUsage() ([]*diskUsage, error) {
+	containers, err := state.List()
+	if err != nil {
+		return nil, err
+	}
+	used, err := usedImages()
+	if err != nil {
+		return nil, err
+	}
+
+	images := &diskUsage{Type: "Images"}
+	files, err := ioutil.ReadDir(container.ImageStoreURL)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".tar") {
+			continue
+		}
+		storeName := strings.TrimSuffix(f.Name(), ".tar")
+		size := f.Size() + dirSize(filepath.Join(container.ImageStoreURL, storeName))
+		images.Total++
+		images.Size += size
+		if used[storeName] {
+			images.Active++
+		} else {
+			images.Reclaimable += size
+		}
+	}
+
+	containerUsage := &diskUsage{Type: "Containers"}
+	volumes := &diskUsage{Type: "Local Volumes"}
+	seenVolumes := map[string]bool{}
+	for _, info := range containers {
+		size := containerSize(info)
+		containerUsage.Total++
+		containerUsage.Size += size
+		if info.IsRunning() {
+			containerUsage.Active++
+		} else {
+			containerUsage.Reclaimable += size
+		}
+
+		// 数据卷不会被清理
+		volumeURLs := strings.Split(info.Volume, ":")
+		if len(volumeURLs) != 2 || volumeURLs[0] == "" || seenVolumes[volumeURLs[0]] {
+			continue
+		}
+		seenVolumes[volumeURLs[0]] = true
+		volumes.Total++
+		volumes.Size += dirSize(volumeURLs[0])
+		if info.IsRunning() {
+			volumes.Active++
+		}
+	}
+
+	// 崩溃后残留的可写层与临时文件
+	leftovers := &diskUsage{Type: "Leftovers"}
+	keys, err := workSpaceKeys()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range orphanDirs(container.WriteLayerUrl, keys) {
+		leftovers.Total++
+		leftovers.Size += dirSize(fmt.Sprintf(container.WriteLayerUrl, name))
+	}
+	for _, f := range files {
+		if isTempImageFile(f.Name()) {
+			leftovers.Total++
+			leftovers.Size += dirSize(filepath.Join(container.ImageStoreURL, f.Name()))
+		}
+	}
+	leftovers.Reclaimable = leftovers.Size
+
+	return []*diskUsage{images, containerUsage, volumes, leftovers}, nil
+}
+
+func printDiskUsage(usages []*diskUsage) {
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "TYPE\tTOTAL\tACTIVE\tSIZE\tRECLAIMABLE\n")
+	for _, u := range usages {
+		fmt.Fprintf(w, "%s\t%d\t%d\t%s\t%s\n",
+			u.Type, u.Total, u.Active, humanSize(u.Size), humanSize(u.Reclaimable))
+	}
+	if err := w.Flush(); err != nil {
+		logrus.Errorf("Flush error:%v", err)
+	}
+}
+
+// 工作空间的目录名，即所有容器的 ID，包括正在启动、还没有 config.json 的容器
+// 还没有迁移的运行中的旧版本容器，工作空间以容器名命名
+func workSpaceKeys() (map[string]bool, error) {
+	keys, err := containerNames()
+	if err != nil {
+		return nil, err
+	}
+	ids, err := state.IDs()
+	if err != nil {
+		return nil, err
+	}
+	for id := range ids {
+		keys[id] = true
+	}
+	return keys, nil
+}
+
+// 所有容器的名字，包括正在启动的容器已经占用的名字
+func containerNames() (map[string]bool, error) {
+	containers, err := state.List()
+	if err != nil {
+		return nil, err
+	}
+	names, err := state.Names()
+	if err != nil {
+		return nil, err
+	}
+	for _, info := range containers {
+		names[info.Name] = true
+	}
+	return names, nil
+}
+
+// 被容器使用的镜像，key 为镜像在 ${root}/images 下存储的名字
+func usedImages() (map[string]bool, error) {
+	containers, err := state.List()
+	if err != nil {
+		return nil, err
+	}
+	used := map[string]bool{}
+	for _, info := range containers {
+		if info.Image != "" {
+			used[container.ImageStoreName(info.Image)] = true
+		}
+	}
+	return used, nil
+}
+
+// 列出 format (如 ${state}/mnt/%s) 所在目录中不属于任何容器的子目录
+func orphanDirs(format string, names map[string]bool) []string {
+	parent := filepath.Dir(fmt.Sprintf(format, "_"))
+	files, err := ioutil.ReadDir(parent)
+	if err != nil {
+		return nil
+	}
+	var orphans []string
+	for _, f := range files {
+		if f.IsDir() && !names[f.Name()] {
+			orphans = append(orphans, f.Name())
+		}
+	}
+	return orphans
+}
+
+// archive.UntarAtomic 残留的临时目录，以及 import、commit 残留的临时文件
+func isTempImageFile(name string) bool {
+	return (strings.HasPrefix(name, ".") && strings.Contains(name, ".tmp-")) ||
+		strings.HasPrefix(name, ".import-") || strings.HasPrefix(name, ".commit-")
+}
+
+// 容器占用的空间，包括可写层与日志等信息
+func containerSize(info *container.ContainerInfo) int64 {
+	return dirSize(fmt.Sprintf(container.WriteLayerUrl, info.ID)) +
+		dirSize(fmt.Sprintf(container.DefaultInfoLocation, info.ID))
+}
+
+// 目录下所有文件的大小，不跟随符号链接，不进入其它挂载点
+func dirSize(dir string) int64 {
+	rootInfo, err := os.Lstat(dir)
+	if err != nil {
+		return 0
+	}
+	rootDev := rootInfo.Sys().(*syscall.Stat_t).Dev
+	var size int64
+	filepath.Walk(dir, func(p string, info os.FileInfo, err error) error {
+		if err != nil {
+			return nil
+		}
+		if info.IsDir() && info.Sys().(*syscall.Stat_t).Dev != rootDev {
+			return filepath.SkipDir
+		}
+		if info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// 以 KB、MB 等单位显示大小
+func humanSize(size int64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	value := float64(size)
+	i := 0
+	for value >= 1000 && i < len(units)-1 {
+		value /= 1000
+		i++
+	}
+	if i == 0 {
+		return fmt.Sprintf("%dB", size)
+	}
+	return fmt.Sprintf("%.3g%s", value, units[i])
+}
+
+// 清理前的确认
+func confirmPrune(warning string) bool {
+	fmt.Fprintf(os.Stdout, "WARNING! %s\nAre you sure you want to continue? [y/N] ", warning)
+	var answer string
+	fmt.Fscanln(os.Stdin, &answer)
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"copyDocker/container"
+	"copyDocker/internal/testutil"
+	"copyDocker/state"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+	"time"
+)
+
+// 在 ${root}/images 下创建镜像文件、只读层与临时文件
+func setupImages(t *testing.T, names []string) {
+	if err := container.CreatePaths(); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range names {
+		p := filepath.Join(container.ImageStoreURL, name)
+		var err error
+		if filepath.Ext(name) == ".tar" || filepath.Ext(name) == ".json" {
+			err = ioutil.WriteFile(p, []byte(name), 0644)
+		} else {
+			err = os.MkdirAll(filepath.Join(p, "bin"), 0755)
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func listImages(t *testing.T) []string {
+	files, err := ioutil.ReadDir(container.ImageStoreURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, f := range files {
+		if f.Name() != ".lock" {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestPruneImages(t *testing.T) {
+	tests := []struct {
+		name string
+		all  bool
+		want []string
+	}{
+		{name: "layers", want: []string{"unused.json", "unused.tar", "used", "used.tar"}},
+		{name: "all", all: true, want: []string{"used", "used.tar"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.SetupRoot(t)
+			setupImages(t, []string{"used.tar", "used", "unused.tar", "unused", "unused.json", ".unused.tmp-1", ".import-2"})
+			info := &container.ContainerInfo{ID: "0123456789", Name: "prune-test", Image: "used", Status: container.Exit}
+			if err := state.Create(info.ID); err != nil {
+				t.Fatal(err)
+			}
+			if err := state.Save(info); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := pruneImages(tt.all, nil); err != nil {
+				t.Fatalf("pruneImages error %v", err)
+			}
+			if got := listImages(t); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("images after prune = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// 正在启动的容器还没有写入容器信息，prune 等到其释放镜像的锁之后才判断镜像是否被使用
+func TestPruneImagesWaitsForStartingContainer(t *testing.T) {
+	testutil.SetupRoot(t)
+	setupImages(t, []string{"busybox.tar", "busybox"})
+	unlock, err := container.LockImages(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan error)
+	go func() {
+		_, err := pruneImages(false, nil)
+		done <- err
+	}()
+	select {
+	case err := <-done:
+		unlock()
+		t.Fatalf("pruneImages returned while an image lock is held: %v", err)
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	// 容器记录了使用的镜像之后释放锁
+	info := &container.ContainerInfo{ID: "0123456789", Name: "starting", Image: "busybox", Status: container.RUNNING}
+	if err := state.Create(info.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Save(info); err != nil {
+		t.Fatal(err)
+	}
+	unlock()
+	if err := <-done; err != nil {
+		t.Fatalf("pruneImages error %v", err)
+	}
+	if got, want := listImages(t), []string{"busybox", "busybox.tar"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("images after prune = %v, want %v", got, want)
+	}
+}
+
+func TestIsTempImageFile(t *testing.T) {
+	tests := []struct {
+		name string
+		want bool
+	}{
+		{name: ".busybox.tmp-123", want: true},
+		{name: ".import-123", want: true},
+		{name: ".commit-123", want: true},
+		{name: ".lock"},
+		{name: "busybox.tar"},
+		{name: "busybox.tmp-123"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isTempImageFile(tt.name); got != tt.want {
+				t.Errorf("isTempImageFile(%q) = %v, want %v", tt.name, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHumanSize(t *testing.T) {
+	tests := []struct {
+		size int64
+		want string
+	}{
+		{size: 0, want: "0B"},
+		{size: 999, want: "999B"},
+		{size: 1000, want: "1KB"},
+		{size: 1234567, want: "1.23MB"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := humanSize(tt.size); got != tt.want {
+				t.Errorf("humanSize(%d) = %q, want %q", tt.size, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"copyDocker/container"
+	"copyDocker/state"
+	"fmt"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 15:40 2022/3/30
+ @Description: docker rename 的实现
+*/
+
+// 重命名容器，容器信息的目录与工作空间都以 ID 命名，只需更新容器名
+// monitor 启动容器时会写回它持有的容器信息，因此只能重命名已停止的容器
+func renameContainer(oldName, newName string) error {
+	info, err := lookupContainer(oldName)
+	if err != nil {
+		return err
+	}
+	if info.Name == newName {
+		return fmt.Errorf("container %s is already named %s", oldName, newName)
+	}
+	if info.IsRunning() {
+		return fmt.Errorf("container %s is running, stop it before renaming", oldName)
+	}
+	// monitor 退出前还会更新容器信息
+	if !waitContainerStopped(info, monitorExitTimeout) {
+		return fmt.Errorf("the monitor of container %s is still running", oldName)
+	}
+	if err := reserveContainerName(newName, info.ID); err != nil {
+		return err
+	}
+	err = state.Update(info.ID, func(info *container.ContainerInfo) error {
+		info.Name = newName
+		return nil
+	})
+	if err != nil {
+		state.ReleaseName(newName, info.ID)
+		return err
+	}
+	state.ReleaseName(info.Name, info.ID)
+	return nil
+}
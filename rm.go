@@ -0,0 +1,151 @@
+package main
+
+import (
+	"copyDocker/cgroups"
+	"copyDocker/container"
+	"copyDocker/network"
+	"copyDocker/state"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"os"
+	"strconv"
+	"syscall"
+	"text/tabwriter"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 16:30 2022/3/31
+ @Description: docker rm 的实现，删除容器的进程、网络端点、cgroup、工作空间、数据卷与容器信息
+*/
+
+// 删除容器后仍然残留的资源
+type removeReport struct {
+	Resources [][2]string // 资源类型与路径
+}
+
+func (r *removeReport) add(kind, resource string) {
+	r.Resources = append(r.Resources, [2]string{kind, resource})
+}
+
+func (r *removeReport) print(info *container.ContainerInfo) {
+	fmt.Fprintf(os.Stderr, "Container %s (%s) was not removed completely, remaining resources:\n", info.Name, shortID(info.ID))
+	w := tabwriter.NewWriter(os.Stderr, 12, 1, 3, ' ', 0)
+	for _, resource := range r.Resources {
+		fmt.Fprintf(w, "  %s\t%s\n", resource[0], resource[1])
+	}
+	w.Flush()
+}
+
+// 删除容器，运行中的容器需要 force，先 kill 再删除
+// removeVolumes 为 true 时同时删除匿名数据卷
+func removeContainer(containerName string, force, removeVolumes bool) error {
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if info.IsRunning() {
+		if !force {
+			return fmt.Errorf("container %s is running, stop it before removing or use rm -f", containerName)
+		}
+		if err := forceStopContainer(info); err != nil {
+			return err
+		}
+	}
+	return deleteContainer(info, removeVolumes)
+}
+
+// 标记手动停止后 kill 容器，等待容器与 monitor 退出
+// 在退避中等待重启的 monitor 醒来后发现容器已被删除，会直接退出，不需要等待
+func forceStopContainer(info *container.ContainerInfo) error {
+	if err := markManuallyStopped(info); err != nil {
+		return err
+	}
+	if !info.IsAlive() {
+		return nil
+	}
+	pid, err := strconv.Atoi(info.Pid)
+	if err != nil {
+		return fmt.Errorf("invalid pid %s of container %s", info.Pid, info.Name)
+	}
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return fmt.Errorf("kill container %s error %v", info.Name, err)
+	}
+	thawIfPaused(info)
+	if !waitContainerStopped(info, monitorExitTimeout) {
+		return fmt.Errorf("container %s did not exit after SIGKILL", info.Name)
+	}
+	return nil
+}
+
+// 删除已停止容器的全部资源，最后检查是否有残留
+// 有资源删除失败时保留容器信息，之后可以再次 rm，只删除失败的部分
+func deleteContainer(info *container.ContainerInfo, removeVolumes bool) error {
+	report := &removeReport{}
+
+	// 网络端点，删除失败的保留在容器信息中
+	var endpoints []container.Endpoint
+	if len(info.Endpoints) > 0 {
+		if err := network.Init(); err != nil {
+			return err
+		}
+		for _, ep := range info.Endpoints {
+			if err := network.Disconnect(ep); err != nil {
+				logrus.Warnf("Disconnect endpoint %s error %v", ep.ID, err)
+				endpoints = append(endpoints, ep)
+				report.add("endpoint", ep.ID)
+			}
+		}
+	}
+
+	// detach 运行的容器在 monitor 异常退出时会残留 cgroup
+	cgroupManager := cgroups.NewCgroupManager(cgroups.ContainerPath(info.ID))
+	if err := cgroupManager.Destroy(); err != nil {
+		logrus.Warnf("Remove cgroup of container %s error %v", info.Name, err)
+	}
+	for _, cgroupPath := range cgroupManager.Paths() {
+		report.add("cgroup", cgroupPath)
+	}
+
+	// 工作空间没有卸载干净时不删除数据卷，避免删除仍挂载在容器中的数据
+	workSpaceErr := container.DeleteWorkSpace(info.Volume, info.ID)
+	if workSpaceErr != nil {
+		logrus.Warnf("Delete workspace of container %s error %v", info.Name, workSpaceErr)
+	}
+	for _, url := range []string{fmt.Sprintf(container.MntURL, info.ID), fmt.Sprintf(container.WriteLayerUrl, info.ID)} {
+		if exist, _ := container.PathExists(url); exist {
+			report.add("workspace", url)
+		}
+	}
+
+	if removeVolumes && workSpaceErr == nil {
+		for _, url := range removeAnonymousVolumes(info) {
+			report.add("volume", url)
+		}
+	}
+
+	if len(report.Resources) > 0 {
+		err := state.Update(info.ID, func(info *container.ContainerInfo) error {
+			info.Endpoints = endpoints
+			return nil
+		})
+		if err != nil {
+			report.add("state", state.Dir(info.ID))
+		}
+		report.print(info)
+		return fmt.Errorf("remove container %s incompletely", info.Name)
+	}
+	return state.Remove(info)
+}
+
+// 删除容器的匿名数据卷，返回删除失败的目录
+func removeAnonymousVolumes(info *container.ContainerInfo) []string {
+	var failed []string
+	for _, url := range info.AnonymousVolumes {
+		if err := os.RemoveAll(url); err != nil {
+			logrus.Warnf("Remove volume %s error %v", url, err)
+			failed = append(failed, url)
+		}
+	}
+	return failed
+}
@@ -4,13 +4,13 @@ import (
 	"copyDocker/cgroups"
 	"copyDocker/cgroups/subsystems"
 	"copyDocker/container"
-	"encoding/json"
+	"copyDocker/state"
 	"fmt"
 	"github.com/sirupsen/logrus"
-	"math/rand"
 	"os"
+	"os/exec"
 	"strconv"
-	"strings"
+	"syscall"
 	"time"
 )
 
@@ -20,130 +20,310 @@ import (
  @Description: copyDocker
 */
 
+// 容器启动失败时 run 命令的退出码，与容器命令的退出码区分
+const runErrorExitCode = 125
+
+// RunOptions run 命令的参数
+type RunOptions struct {
+	Tty           bool                       // 是否交互运行
+	AutoRemove    bool                       // 退出后是否删除容器
+	Volume        string                     // 数据卷
+	ContainerName string                     // 容器名，为空时使用容器 ID
+	ImageName     string                     // 镜像名
+	Resource      *subsystems.ResourceConfig // 资源限制
+	LogMaxSize    int64                      // 后台容器单个日志文件的最大字节数
+	LogMaxFiles   int                        // 后台容器最多保留的日志文件数
+	RestartPolicy container.RestartPolicy    // 重启策略，仅后台运行时有效
+	StopSignal    string                     // stop 时发送的信号
+	Labels        map[string]string          // 用户设置的标签，与镜像的标签合并
+}
+
 // Run Start 方法前的调用，即init的实现。首先 clone 一个 namespace 隔离进程
 // 然后，在子进程中，调用/proc/self/exe(即自己)，发送init参数，就是实现了init初始化,
 // 使用 pivot_root 将 root 目录切换 pivot new_root put_old
-func Run(tty bool, comArray []string, volume string, res *subsystems.ResourceConfig,
-	containerName, imageName string, envSlice []string) {
+// 后台运行时由 monitor 进程调用，容器退出后才会返回，返回值为容器的退出码
+func Run(opts *RunOptions, initConfig *container.InitConfig) (int, error) {
+	containerID, err := newContainerID()
+	if err != nil {
+		return -1, err
+	}
 	// 保证容器名不为空
-	containerID := randStringBytes(10)
+	containerName := opts.ContainerName
 	if containerName == "" {
-		containerName = containerID
+		containerName = shortID(containerID)
+	}
+	if initConfig.Hostname == "" {
+		initConfig.Hostname = shortID(containerID)
+	}
+	// 容器名必须唯一，之后的命令才能通过名字找到容器
+	if err := reserveContainerName(containerName, containerID); err != nil {
+		os.RemoveAll(state.Dir(containerID))
+		return -1, err
 	}
 
-	parent, writePipe := container.NewParentProcess(tty, volume, containerName,
-		imageName,envSlice)
-	if parent == nil {
-		logrus.Errorf("Create New Process error")
-		return
+	// 没有指定 stop 信号时使用镜像的，都没有时 stop 发送 SIGTERM
+	stopSignal := opts.StopSignal
+	if stopSignal == "" {
+		stopSignal = imageStopSignal(opts.ImageName)
 	}
-	if err := parent.Start(); err != nil {
-		logrus.Error(err)
+
+	// 记录启动容器所需的全部配置，start 时据此重新创建容器
+	info := &container.ContainerInfo{
+		ID:          containerID,
+		Name:        containerName,
+		Command:     initConfig.Args,
+		CreatedTime: time.Now().Format("2006-01-02 15:04:05"),
+		Volume:      opts.Volume,
+		Image:       opts.ImageName,
+		Tty:         opts.Tty,
+		AutoRemove:  opts.AutoRemove,
+		LogMaxSize:  opts.LogMaxSize,
+		LogMaxFiles: opts.LogMaxFiles,
+		Resource:    opts.Resource,
+		Config:      initConfig,
+
+		RestartPolicy: opts.RestartPolicy,
+		StopSignal:    stopSignal,
+		// 继承镜像的标签，用户设置的同名标签优先
+		Labels: mergeLabels(imageLabels(opts.ImageName), opts.Labels),
+	}
+	// 匿名数据卷的目录在创建容器时确定，之后 start 复用同一个目录
+	volume, anonymousVolume, err := container.NewAnonymousVolume(opts.Volume)
+	if err != nil {
+		delContainerInfo(info)
+		return -1, err
+	}
+	if anonymousVolume != "" {
+		info.Volume = volume
+		info.AnonymousVolumes = []string{anonymousVolume}
 	}
+	exitCode, err := runContainer(info, opts.Tty, true)
+	if err != nil {
+		// 释放容器 ID 与容器名
+		delContainerInfo(info)
+		removeAnonymousVolumes(info)
+		return -1, err
+	}
+	// 后台运行时，monitor 按照重启策略重启退出的容器
+	if !opts.Tty && !info.RestartPolicy.IsNone() {
+		superviseContainer(info.ID)
+	}
+	return exitCode, nil
+}
 
-	// 记录容器信息,并返回容器名
-	containerName, err := recordContainerInfo(parent.Process.Pid, comArray, containerName,containerID, volume)
+// 镜像的 stop 信号，镜像中的信号无效时忽略
+func imageStopSignal(image string) string {
+	config, err := container.LoadImageConfig(image)
 	if err != nil {
-		logrus.Errorf("Record container info error: %v", err)
-		return
+		logrus.Warnf("Load config of image %s error %v", image, err)
+		return ""
 	}
+	if config.StopSignal == "" {
+		return ""
+	}
+	if _, err := container.ParseSignal(config.StopSignal); err != nil {
+		logrus.Warnf("Ignore stop signal of image %s: %v", image, err)
+		return ""
+	}
+	return config.StopSignal
+}
+
+// 创建容器的 namespace、cgroup 与工作空间，启动容器进程并等待其退出，返回容器的退出码
+// created 表示容器是新建的，启动失败时删除容器；否则为 start 已有的容器，失败时只恢复之前的状态
+func runContainer(info *container.ContainerInfo, tty, created bool) (int, error) {
+	containerName := info.Name
+	// start 失败时恢复的状态
+	previous := *info
 
 	// 创建 cgroup manager，通过 set 设置，apply加入实现资源限制
-	cgroupManager := cgroups.NewCgroupManager(containerID)
+	// 在启动容器进程之前创建 cgroup 并设置资源，失败时不会创建任何进程
+	cgroupManager := cgroups.NewCgroupManager(cgroups.ContainerPath(info.ID))
 	defer cgroupManager.Destroy()
-	// set 设置资源
-	cgroupManager.Set(res)
-	// 将容器进程加入到各个 subsystem 挂载对应的cgroup中
-	cgroupManager.Apply(parent.Process.Pid)
-	// 限制完后，开始初始化,并写入命令
-	sendInitCommand(comArray, writePipe)
+	if err := cgroupManager.Set(info.Resource); err != nil {
+		return -1, fmt.Errorf("set cgroup resource error: %v", err)
+	}
 
-	// 如果要交互，才进行等待
-	// 也就是如果加了 -d，父级进程就会直接退出，子进程为孤儿进程，由 init 管理
-	if tty {
-		parent.Wait()
-		delContainerInfo(containerName)
-		container.DeleteWorkSpace(volume, containerName)
+	// 父进程中的管道，包括尚未交给子进程的一端
+	var pipes []*os.File
+	closePipes := func() {
+		for _, f := range pipes {
+			f.Close()
+		}
+		pipes = nil
 	}
 
-}
+	rollback := func(parent *exec.Cmd) {
+		closePipes()
+		if created {
+			rollbackRun(parent, info)
+			return
+		}
+		killParent(parent)
+		if err := state.Save(&previous); err != nil {
+			logrus.Errorf("Save container %s info error %v", containerName, err)
+		}
+	}
 
-// 记录容器的信息
-func recordContainerInfo(containerPID int, commandArray []string, containerName,id, volume string) (string, error) {
+	// 写入容器信息之前 prune 不知道只读层正在被使用，持有镜像的共享锁直到记录了容器信息
+	unlockImages, err := container.LockImages(false)
+	if err != nil {
+		rollback(nil)
+		return -1, err
+	}
+	releaseImages := func() {
+		if unlockImages != nil {
+			unlockImages()
+			unlockImages = nil
+		}
+	}
+	defer releaseImages()
 
-	// 当前时间创的容器
-	createTime := time.Now().Format("2006-01-02 15:04:05")
-	command := strings.Join(commandArray, "")
+	parent, writePipe, syncPipe, err := container.NewParentProcess(tty, info.Volume, info.ID, info.Image)
+	if err != nil {
+		rollback(nil)
+		return -1, fmt.Errorf("create new process error: %v", err)
+	}
+	pipes = append([]*os.File{writePipe, syncPipe}, parent.ExtraFiles...)
+	// 后台运行时，容器的输出经由 monitor 写入日志文件
+	if !tty {
+		logPath := fmt.Sprintf(container.DefaultInfoLocation, info.ID) + container.ContainerLogFile
+		logWriter, err := container.NewRotateLogWriter(logPath, info.LogMaxSize, info.LogMaxFiles)
+		if err != nil {
+			rollback(nil)
+			return -1, fmt.Errorf("open log file %s error %v", logPath, err)
+		}
+		defer logWriter.Close()
+		parent.Stdout = logWriter
+		parent.Stderr = logWriter
+	}
+	if err := parent.Start(); err != nil {
+		rollback(nil)
+		return -1, fmt.Errorf("start container process error: %v", err)
+	}
+	// 关闭父进程中属于子进程一端的管道，否则同步管道读不到 EOF
+	for _, f := range parent.ExtraFiles {
+		f.Close()
+	}
+	pipes = []*os.File{writePipe, syncPipe}
 
-	// 对应的信息实体
-	containerInfo := &container.ContainerInfo{
-		ID:          id,
-		Pid:         strconv.Itoa(containerPID),
-		Command:     command,
-		CreatedTime: createTime,
-		Status:      container.RUNNING,
-		Name:        containerName,
-		Volume:      volume,
+	// 将容器进程加入到各个 subsystem 挂载对应的cgroup中
+	// 此时 init 阻塞在读取配置管道上，用户命令还未执行，加入 cgroup 之后才发送配置
+	if err := cgroupManager.Apply(parent.Process.Pid); err != nil {
+		rollback(parent)
+		return -1, fmt.Errorf("apply cgroup error: %v", err)
 	}
 
-	// json 序列化
-	jsonByte, err := json.Marshal(containerInfo)
-	if err != nil {
-		logrus.Errorf("Record container error %v", err)
-		return "", err
+	// 记录容器信息
+	if err := recordContainerInfo(info, parent.Process.Pid); err != nil {
+		rollback(parent)
+		return -1, fmt.Errorf("record container info error: %v", err)
 	}
-	jsonStr := string(jsonByte)
+	releaseImages()
 
-	// 存储容器信息的路径
-	// /var/run/copyDocker/${}
-	dirUrl := fmt.Sprintf(container.DefaultInfoLocation, containerName)
-	// 如果路径不存在
-	if err := os.MkdirAll(dirUrl, 0622); err != nil {
-		logrus.Errorf("Mkdir error %s , %v", dirUrl, err)
-		return "", err
+	// 限制完后，开始初始化,并写入配置
+	if err := container.SendInitConfig(info.Config, writePipe); err != nil {
+		rollback(parent)
+		return -1, fmt.Errorf("start container %s error: %v", containerName, err)
+	}
+	// 等待 init 初始化完成，失败时回滚已经创建的资源，并输出真正的原因
+	if err := container.WaitInitReady(syncPipe); err != nil {
+		rollback(parent)
+		return -1, fmt.Errorf("start container %s error: %v", containerName, err)
 	}
+	// init 已经就绪，之后不再使用管道
+	closePipes()
 
-	// /var/run/copyDocker/${}/config.json
-	fileName := dirUrl + "/" + container.ConfigName
-	// 创建最终的配置文件 config.json
-	file, err := os.Create(fileName)
-	defer file.Close()
-	if err != nil {
-		logrus.Errorf("Create file %s error %v.", fileName, err)
-		return "", err
+	// 如果加了 -d，当前进程即为 monitor，通知 run 命令容器已经启动，之后在后台等待容器退出
+	if !tty {
+		notifyMonitorParent(container.SyncMessage{Type: container.SyncReady, Message: info.ID})
+		redirectMonitorLog(info.ID)
 	}
-	// 将 json 化之后的数据写入文件中
-	if _, err := file.WriteString(jsonStr); err != nil {
-		logrus.Errorf("File Write string error %v", err)
-		return "", err
+	parent.Wait()
+	exitCode := processExitCode(parent.ProcessState)
+	// 在 defer 的 Destroy 之前读取 OOM 计数
+	markContainerExited(info.ID, exitCode, cgroupManager.OOMKilled())
+	// --rm 时退出后删除容器与匿名数据卷，否则保留退出状态与工作空间
+	// 工作空间没有卸载干净时保留容器，之后由 rm 重试
+	if info.AutoRemove {
+		if err := container.DeleteWorkSpace(info.Volume, info.ID); err != nil {
+			logrus.Errorf("Delete workspace of container %s error %v", containerName, err)
+			return exitCode, nil
+		}
+		delContainerInfo(info)
+		removeAnonymousVolumes(info)
 	}
+	return exitCode, nil
+}
 
-	return containerName, err
+// 容器启动失败时，杀掉 init 进程，并清理工作空间与容器信息
+// cgroup 由 runContainer 中 defer 的 Destroy 释放
+func rollbackRun(parent *exec.Cmd, info *container.ContainerInfo) {
+	killParent(parent)
+	delContainerInfo(info)
+	if err := container.DeleteWorkSpace(info.Volume, info.ID); err != nil {
+		logrus.Errorf("Delete workspace of container %s error %v", info.Name, err)
+	}
 }
 
-// 删除当前容器信息
-func delContainerInfo(containerName string) {
-	// /var/run/copyDocker/${}
-	dirURL := fmt.Sprintf(container.DefaultInfoLocation, containerName)
-	if err := os.RemoveAll(dirURL); err != nil {
-		logrus.Errorf("Remove dir %s error %v", dirURL, err)
+// 杀掉并回收启动失败的 init 进程
+func killParent(parent *exec.Cmd) {
+	if parent != nil && parent.Process != nil {
+		parent.Process.Kill()
+		parent.Wait()
 	}
 }
 
-func sendInitCommand(cmdArray []string, writePipe *os.File) {
-	command := strings.Join(cmdArray, " ")
-	logrus.Infof("command all is %s", command)
-	writePipe.WriteString(command)
-	writePipe.Close()
+// 记录容器进程的信息，状态改为 running
+func recordContainerInfo(info *container.ContainerInfo, containerPID int) error {
+	// 记录进程的启动时间，之后据此判断 PID 是否被复用
+	pid := strconv.Itoa(containerPID)
+	pidStartTime, err := container.ProcessStartTime(pid)
+	if err != nil {
+		logrus.Warnf("Get start time of process %s error %v", pid, err)
+	}
+
+	info.Pid = pid
+	info.PidStartTime = pidStartTime
+	info.MonitorPid = strconv.Itoa(os.Getpid())
+	info.MonitorStartTime, _ = container.ProcessStartTime(info.MonitorPid)
+	info.Status = container.RUNNING
+	info.StartedAt = time.Now()
+	info.FinishedAt = time.Time{}
+	info.ExitCode = 0
+	info.OOMKilled = false
+	return state.Save(info)
+}
+
+// 进程的退出码，无法得知时为 -1
+func processExitCode(state *os.ProcessState) int {
+	if state == nil {
+		return -1
+	}
+	if status, ok := state.Sys().(syscall.WaitStatus); ok {
+		return container.ExitCode(status)
+	}
+	return -1
+}
+
+// 记录容器的退出状态：退出码、是否被 OOM 杀死以及退出时间
+func markContainerExited(containerID string, exitCode int, oomKilled bool) {
+	err := state.Update(containerID, func(info *container.ContainerInfo) error {
+		info.Status = container.Exit
+		info.Pid = ""
+		info.ExitCode = exitCode
+		info.OOMKilled = oomKilled
+		info.FinishedAt = time.Now()
+		return nil
+	})
+	// 自动删除的容器可能已经被删除
+	if err != nil && !os.IsNotExist(err) {
+		logrus.Errorf("Save container %s info error %v", containerID, err)
+	}
 }
 
-// 随机一个 container ID
-func randStringBytes(n int) string {
-	letterBytes := "1234567890"
-	rand.Seed(time.Now().UnixNano())
-	b := make([]byte, n)
-	for i := range b {
-		b[i] = letterBytes[rand.Intn(len(letterBytes))]
+// 删除当前容器信息，并释放容器名
+func delContainerInfo(info *container.ContainerInfo) {
+	if err := state.Remove(info); err != nil {
+		logrus.Errorf("Remove container %s info error %v", info.Name, err)
 	}
-	return string(b)
 }
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"copyDocker/container"
+	"copyDocker/state"
+	"fmt"
+	"time"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 20:05 2022/3/28
+ @Description: docker start、restart 的实现
+*/
+
+// 上一个 monitor 记录退出状态、清理 cgroup 的最长等待时间
+const monitorExitTimeout = 10 * time.Second
+
+// 在 monitor 中重新启动已退出的容器
+// 使用记录的配置重新创建 namespace、cgroup 与挂载，复用原来的可写层，ID、名字与日志不变
+func startContainer(containerName string) error {
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	if info.IsAlive() {
+		return fmt.Errorf("container %s is already running", containerName)
+	}
+	if info.Status == container.RESTARTING {
+		return fmt.Errorf("container %s is restarting, stop it first", containerName)
+	}
+	if info.Config == nil {
+		return fmt.Errorf("container %s was created by an older version and can not be started", containerName)
+	}
+	if err := checkDetachable(info); err != nil {
+		return err
+	}
+	// 等上一个 monitor 退出，否则它会覆盖新的状态并删除同名的 cgroup
+	wakeMonitor(info)
+	if !waitContainerStopped(info, monitorExitTimeout) {
+		return fmt.Errorf("the monitor of container %s is still running", containerName)
+	}
+	// monitor 退出前更新了容器信息，重新读取
+	if info, err = state.Load(info.ID); err != nil {
+		return err
+	}
+	// 手动启动后重新按照重启策略计数
+	info.ManuallyStopped = false
+	info.RestartCount = 0
+	if _, err := runContainer(info, false, false); err != nil {
+		return err
+	}
+	if !info.RestartPolicy.IsNone() {
+		superviseContainer(info.ID)
+	}
+	return nil
+}
+
+// 重启容器，运行中的容器先停止，之后交给新的 monitor 启动
+func restartContainer(containerName string, timeout time.Duration) error {
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	// 在停止容器之前检查，避免停止之后无法再启动
+	if err := checkDetachable(info); err != nil {
+		return err
+	}
+	// 标记为手动停止，原来的 monitor 不会再按照重启策略重启容器
+	if err := markManuallyStopped(info); err != nil {
+		return err
+	}
+	if info.IsAlive() {
+		if err := stopAndWait(info, timeout); err != nil {
+			return err
+		}
+	} else {
+		// 容器没有进程，monitor 可能正在等待重启
+		wakeMonitor(info)
+		if !waitContainerStopped(info, monitorExitTimeout) {
+			return fmt.Errorf("the monitor of container %s is still running", containerName)
+		}
+	}
+	return startMonitor()
+}
+
+// start 与 restart 只能在后台由 monitor 启动容器，交互运行的容器需要终端，不能这样启动
+func checkDetachable(info *container.ContainerInfo) error {
+	if info.Tty {
+		return fmt.Errorf("container %s was created with -ti and can not be started in the background, use run -ti to create a new container", info.Name)
+	}
+	return nil
+}
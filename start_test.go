@@ -0,0 +1,83 @@
+package main
+
+import (
+	"copyDocker/container"
+	"copyDocker/internal/testutil"
+	"copyDocker/state"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestStartTtyContainer(t *testing.T) {
+	testutil.SetupRoot(t)
+	info := &container.ContainerInfo{
+		ID:     "0123456789",
+		Name:   "tty",
+		Status: container.Exit,
+		Tty:    true,
+		Config: &container.InitConfig{Args: []string{"sh"}},
+	}
+	if err := state.Create(info.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err := state.Save(info); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := startContainer("tty"); err == nil || !strings.Contains(err.Error(), "-ti") {
+		t.Errorf("startContainer() error = %v, want error about -ti", err)
+	}
+	if err := restartContainer("tty", time.Second); err == nil || !strings.Contains(err.Error(), "-ti") {
+		t.Errorf("restartContainer() error = %v, want error about -ti", err)
+	}
+	// restart 在修改状态之前就失败
+	got, err := state.Load(info.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.ManuallyStopped {
+		t.Errorf("restart of a tty container marked it manually stopped")
+	}
+}
+
+// 交互运行的容器记录的是前台的 run 进程，不能向它发送 SIGTERM
+func TestWakeMonitor(t *testing.T) {
+	tests := []struct {
+		name   string
+		tty    bool
+		signal bool
+	}{
+		{name: "monitor", signal: true},
+		{name: "foreground run", tty: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := exec.Command("sleep", "10")
+			if err := cmd.Start(); err != nil {
+				t.Fatal(err)
+			}
+			defer cmd.Process.Kill()
+			waited := make(chan error, 1)
+			go func() { waited <- cmd.Wait() }()
+
+			wakeMonitor(&container.ContainerInfo{Tty: tt.tty, MonitorPid: strconv.Itoa(cmd.Process.Pid)})
+			select {
+			case <-waited:
+				if !tt.signal {
+					t.Errorf("foreground run process was signaled")
+				}
+				if status, ok := cmd.ProcessState.Sys().(syscall.WaitStatus); !ok || status.Signal() != syscall.SIGTERM {
+					t.Errorf("process exited with %v, want SIGTERM", cmd.ProcessState)
+				}
+			case <-time.After(200 * time.Millisecond):
+				if tt.signal {
+					t.Errorf("monitor was not signaled")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package state
+
+import (
+	"copyDocker/container"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 10:20 2022/4/2
+ @Description: 之前版本的容器信息与工作空间的迁移，只在命令启动时由 Migrate 显式进行
+*/
+
+// 迁移期间持有该文件的排它锁，多个命令同时启动时只有一个进行迁移
+const migrateLockFile = ".migrate.lock"
+
+// Migrate 将之前版本的容器迁移到当前格式：以容器名命名的目录改为以 ID 命名，以容器名命名的工作空间改为以 ID 命名，并以当前格式写回
+// 单个容器迁移失败时记录错误并继续，之后启动的命令会再次尝试；运行中容器的工作空间仍在使用，等容器停止后再迁移
+func Migrate() error {
+	pending, err := pendingMigrations()
+	if err != nil || len(pending) == 0 {
+		return err
+	}
+	unlock, err := lockMigrate()
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	// 等待锁期间其它命令可能已经完成了迁移
+	pending, err = pendingMigrations()
+	if err != nil {
+		return err
+	}
+	for dirName, info := range pending {
+		if info.ID != dirName {
+			if err := migrateDir(info, dirName); err != nil {
+				logrus.Errorf("Migrate container %s error %v", info.Name, err)
+				continue
+			}
+		}
+		if err := upgrade(info.ID); err != nil {
+			logrus.Errorf("Migrate container %s error %v", info.ID, err)
+		}
+	}
+	return nil
+}
+
+// 需要迁移的容器，key 为容器信息所在的目录名
+func pendingMigrations() (map[string]*container.ContainerInfo, error) {
+	files, err := ioutil.ReadDir(container.ContainersURL)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	pending := map[string]*container.ContainerInfo{}
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		info, version, err := read(f.Name())
+		if err != nil {
+			continue
+		}
+		if info.ID != f.Name() || version < SchemaVersion {
+			pending[f.Name()] = info
+		}
+	}
+	return pending, nil
+}
+
+// 对迁移加排它锁，返回解锁的函数
+func lockMigrate() (func(), error) {
+	file, err := os.OpenFile(filepath.Join(container.ContainersURL, migrateLockFile), os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("lock %s error %v", file.Name(), err)
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// 在容器的锁的保护下迁移工作空间、修正状态，并以当前格式写回
+func upgrade(id string) error {
+	unlock, err := lock(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	info, version, err := read(id)
+	if err != nil {
+		return err
+	}
+	if version < workSpaceByIDVersion {
+		if isActive(info) {
+			return nil
+		}
+		if err := migrateWorkSpace(info); err != nil {
+			return err
+		}
+	}
+	reconcile(info)
+	return write(info, SchemaVersion)
+}
+
+// 之前版本的容器信息目录以容器名命名，迁移到以 ID 命名的目录，并占用容器名
+func migrateDir(info *container.ContainerInfo, dirName string) error {
+	oldURL := Dir(dirName)
+	newURL := Dir(info.ID)
+	if err := os.Rename(oldURL, newURL); err != nil {
+		return fmt.Errorf("migrate container %s from %s to %s error %v", info.Name, oldURL, newURL, err)
+	}
+	if err := ReserveName(info.Name, info.ID); err != nil {
+		logrus.Warnf("Reserve name of container %s error %v", info.ID, err)
+	}
+	return nil
+}
+
+// 之前版本的可写层与挂载点以容器名命名，迁移到以 ID 命名的目录
+// 挂载点完全卸载后再删除，下次 start 时重新挂载；以 ID 命名的可写层已存在时不覆盖
+func migrateWorkSpace(info *container.ContainerInfo) error {
+	if info.Name == "" || info.Name == info.ID {
+		return nil
+	}
+	oldMntURL := fmt.Sprintf(container.MntURL, info.Name)
+	if exist, _ := container.PathExists(oldMntURL); exist {
+		if err := container.UnmountAll(oldMntURL); err != nil {
+			return fmt.Errorf("umount %s error %v", oldMntURL, err)
+		}
+		if err := os.RemoveAll(oldMntURL); err != nil {
+			logrus.Warnf("Remove mount point %s error %v", oldMntURL, err)
+		}
+	}
+	oldURL := fmt.Sprintf(container.WriteLayerUrl, info.Name)
+	newURL := fmt.Sprintf(container.WriteLayerUrl, info.ID)
+	if exist, _ := container.PathExists(oldURL); !exist {
+		return nil
+	}
+	if exist, _ := container.PathExists(newURL); exist {
+		return fmt.Errorf("migrate write layer of container %s error: %s already exists", info.Name, newURL)
+	}
+	if err := os.Rename(oldURL, newURL); err != nil {
+		return fmt.Errorf("migrate write layer of container %s from %s to %s error %v", info.Name, oldURL, newURL, err)
+	}
+	return nil
+}
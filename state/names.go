@@ -0,0 +1,77 @@
+package state
+
+import (
+	"copyDocker/container"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 14:40 2022/3/31
+ @Description: 容器名与容器 ID 的对应关系
+*/
+
+// 报错时显示的容器 ID 长度
+const shortIDLength = 12
+
+// 记录容器名与容器 ID 对应关系的目录，以 . 开头，不会与容器 ID 及之前版本以容器名命名的目录冲突
+func namesDir() string {
+	return filepath.Join(container.ContainersURL, ".names")
+}
+
+// ReserveName 占用容器名，在 ${root}/containers/.names/ 下创建指向容器 ID 的符号链接，创建成功即占用成功
+// 链接指向的容器已经不存在时，视为残留的链接并覆盖
+func ReserveName(name, id string) error {
+	if err := os.MkdirAll(namesDir(), 0622); err != nil {
+		return err
+	}
+	link := filepath.Join(namesDir(), name)
+	for i := 0; i < 2; i++ {
+		err := os.Symlink(id, link)
+		if err == nil || !os.IsExist(err) {
+			return err
+		}
+		owner, err := os.Readlink(link)
+		if err != nil {
+			return err
+		}
+		if owner == id {
+			return nil
+		}
+		if Exists(owner) {
+			if len(owner) > shortIDLength {
+				owner = owner[:shortIDLength]
+			}
+			return fmt.Errorf("the container name %s is already in use by container %s", name, owner)
+		}
+		os.Remove(link)
+	}
+	return fmt.Errorf("reserve container name %s error", name)
+}
+
+// ReleaseName 释放容器名，只删除指向该容器的链接
+func ReleaseName(name, id string) {
+	link := filepath.Join(namesDir(), name)
+	if owner, err := os.Readlink(link); err == nil && owner == id {
+		os.Remove(link)
+	}
+}
+
+// Names 返回所有已被占用的容器名，正在创建的容器在写入 config.json 之前就已经占用了容器名
+func Names() (map[string]bool, error) {
+	files, err := ioutil.ReadDir(namesDir())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]bool{}, nil
+		}
+		return nil, err
+	}
+	names := map[string]bool{}
+	for _, f := range files {
+		names[f.Name()] = true
+	}
+	return names, nil
+}
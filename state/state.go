@@ -0,0 +1,275 @@
+package state
+
+import (
+	"copyDocker/container"
+	"encoding/json"
+	"fmt"
+	"github.com/sirupsen/logrus"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 14:10 2022/3/31
+ @Description: 容器信息的存储，所有命令都通过这里读写 ${root}/containers/${id}/config.json
+*/
+
+// SchemaVersion 当前 config.json 的格式版本
+// 没有版本号的文件由之前的版本写入，视为版本 0，其中的 command 为拼接后的字符串，由 container.CommandArgs 兼容解析
+// 版本 1 及之前，容器的可写层与挂载点以容器名命名，版本 2 改为以容器 ID 命名
+// 旧版本的文件由 Migrate 在命令启动时迁移，迁移之前读写都保持其原有的版本号
+const SchemaVersion = 2
+
+// 工作空间以容器 ID 命名的版本
+const workSpaceByIDVersion = 2
+
+// 同一容器的读改写通过该文件的 flock 串行
+const lockFile = ".lock"
+
+// config.json 中保存的内容，版本号与容器信息位于同一层
+type record struct {
+	SchemaVersion int `json:"schema_version"`
+	*container.ContainerInfo
+}
+
+// Dir 容器信息所在的目录
+func Dir(id string) string {
+	return fmt.Sprintf(container.DefaultInfoLocation, id)
+}
+
+// Create 创建容器信息的目录，ID 已存在时返回的错误满足 os.IsExist
+func Create(id string) error {
+	if err := os.MkdirAll(container.ContainersURL, 0622); err != nil {
+		return err
+	}
+	return os.Mkdir(Dir(id), 0622)
+}
+
+// Exists 判断容器是否存在
+func Exists(id string) bool {
+	exist, _ := container.PathExists(Dir(id))
+	return exist
+}
+
+// Load 读取容器信息，容器不存在时返回的错误满足 os.IsNotExist
+// 除了修正记录为运行中、但进程已经不存在的容器的状态之外不做任何修改
+func Load(id string) (*container.ContainerInfo, error) {
+	info, _, err := read(id)
+	if err != nil {
+		return nil, err
+	}
+	// 之前版本以容器名命名的目录，迁移之前不能通过 ID 访问
+	if info.ID != id {
+		return nil, fmt.Errorf("container %s under %s is not migrated yet", info.ID, Dir(id))
+	}
+	if !needsReconcile(info) {
+		return info, nil
+	}
+	unlock, err := lock(id)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+	info, version, err := read(id)
+	if err != nil {
+		return nil, err
+	}
+	if needsReconcile(info) {
+		reconcile(info)
+		if err := write(info, version); err != nil {
+			return nil, err
+		}
+	}
+	return info, nil
+}
+
+// List 读取所有容器的信息，跳过目录中不属于容器的内容
+func List() ([]*container.ContainerInfo, error) {
+	files, err := ioutil.ReadDir(container.ContainersURL)
+	if err != nil {
+		// 还没有创建过容器
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var containers []*container.ContainerInfo
+	for _, f := range files {
+		if !f.IsDir() {
+			continue
+		}
+		if exist, _ := container.PathExists(Dir(f.Name()) + container.ConfigName); !exist {
+			continue
+		}
+		info, err := Load(f.Name())
+		if err != nil {
+			logrus.Errorf("Load container %s error %v", f.Name(), err)
+			continue
+		}
+		containers = append(containers, info)
+	}
+	return containers, nil
+}
+
+// IDs 返回所有容器信息目录的 ID，包括正在创建、还没有写入 config.json 的容器
+func IDs() (map[string]bool, error) {
+	files, err := ioutil.ReadDir(container.ContainersURL)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return map[string]bool{}, nil
+		}
+		return nil, err
+	}
+	ids := map[string]bool{}
+	for _, f := range files {
+		if f.IsDir() && !strings.HasPrefix(f.Name(), ".") {
+			ids[f.Name()] = true
+		}
+	}
+	return ids, nil
+}
+
+// Save 写入容器信息，容器目录不存在时报错，不会让已删除的容器重新出现
+// 已有的记录保持原有的版本号，新容器使用当前版本
+func Save(info *container.ContainerInfo) error {
+	unlock, err := lock(info.ID)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	version := SchemaVersion
+	if _, v, err := read(info.ID); err == nil {
+		version = v
+	}
+	return write(info, version)
+}
+
+// Update 在锁的保护下读取、修改并写回容器信息，fn 返回错误时不写入
+func Update(id string, fn func(info *container.ContainerInfo) error) error {
+	unlock, err := lock(id)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	info, version, err := read(id)
+	if err != nil {
+		return err
+	}
+	if err := fn(info); err != nil {
+		return err
+	}
+	return write(info, version)
+}
+
+// Remove 删除容器信息并释放容器名
+func Remove(info *container.ContainerInfo) error {
+	unlock, err := lock(info.ID)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer unlock()
+	if err := os.RemoveAll(Dir(info.ID)); err != nil {
+		return err
+	}
+	ReleaseName(info.Name, info.ID)
+	return nil
+}
+
+// 对容器加排它锁，返回解锁的函数
+// 容器目录不存在时返回的错误满足 os.IsNotExist；等待期间容器被删除时，之后的读写会因为目录不存在而失败
+func lock(id string) (func(), error) {
+	file, err := os.OpenFile(Dir(id)+lockFile, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := syscall.Flock(int(file.Fd()), syscall.LOCK_EX); err != nil {
+		file.Close()
+		return nil, fmt.Errorf("lock container %s error %v", id, err)
+	}
+	return func() {
+		syscall.Flock(int(file.Fd()), syscall.LOCK_UN)
+		file.Close()
+	}, nil
+}
+
+// 读取容器信息及其格式版本
+func read(id string) (*container.ContainerInfo, int, error) {
+	content, err := ioutil.ReadFile(Dir(id) + container.ConfigName)
+	if err != nil {
+		return nil, 0, err
+	}
+	info := &container.ContainerInfo{}
+	rec := record{ContainerInfo: info}
+	if err := json.Unmarshal(content, &rec); err != nil {
+		return nil, 0, fmt.Errorf("unmarshal container %s error %v", id, err)
+	}
+	if rec.SchemaVersion > SchemaVersion {
+		return nil, 0, fmt.Errorf("container %s is written by a newer version (schema %d)", id, rec.SchemaVersion)
+	}
+	return info, rec.SchemaVersion, nil
+}
+
+// 以指定的格式版本写入，先写入临时文件并同步到磁盘，再重命名为 config.json，读取时不会看到写了一半的文件
+func write(info *container.ContainerInfo, version int) error {
+	content, err := json.Marshal(record{SchemaVersion: version, ContainerInfo: info})
+	if err != nil {
+		return fmt.Errorf("json marshal container info error %v", err)
+	}
+	dir := Dir(info.ID)
+	tmpFile, err := ioutil.TempFile(dir, "."+container.ConfigName+"-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+	if _, err := tmpFile.Write(content); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Sync(); err != nil {
+		tmpFile.Close()
+		return err
+	}
+	if err := tmpFile.Close(); err != nil {
+		return err
+	}
+	if err := os.Chmod(tmpFile.Name(), 0622); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), filepath.Join(dir, container.ConfigName))
+}
+
+// 容器进程或 monitor 仍然存在
+func isActive(info *container.ContainerInfo) bool {
+	return info.IsAlive() || info.MonitorAlive()
+}
+
+// 需要修正的容器：monitor 已经不存在的 restarting 容器，以及记录为 running 或 paused、但进程与 monitor 都已经不存在的容器
+func needsReconcile(info *container.ContainerInfo) bool {
+	if info.Status == container.RESTARTING {
+		return !info.MonitorAlive()
+	}
+	return (info.Status == container.RUNNING || info.Status == container.PAUSED) && !info.IsAlive() && !info.MonitorAlive()
+}
+
+// monitor 仍然存在时由它记录退出状态；否则没有进程等待容器退出，无法得知退出码，记为 -1
+func reconcile(info *container.ContainerInfo) {
+	if !needsReconcile(info) {
+		return
+	}
+	if info.Status == container.RESTARTING {
+		info.Status = container.Exit
+		return
+	}
+	info.Status = container.Exit
+	info.Pid = ""
+	info.ExitCode = -1
+	info.FinishedAt = time.Now()
+}
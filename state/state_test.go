@@ -0,0 +1,276 @@
+package state
+
+import (
+	"copyDocker/container"
+	"copyDocker/internal/testutil"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+func writeRecord(t *testing.T, id, content string) {
+	if err := Create(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(Dir(id)+container.ConfigName, []byte(content), 0622); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLoadSchemaVersions(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		command container.CommandArgs
+		wantErr bool
+	}{
+		{
+			name:    "version 0 with legacy command",
+			content: `{"id":"%s","name":"old","command":"sh-ctop","status":"exited"}`,
+			command: container.CommandArgs{"sh-ctop"},
+		},
+		{
+			name:    "version 1",
+			content: `{"schema_version":1,"id":"%s","name":"v1","command":["echo","a b"],"status":"exited"}`,
+			command: container.CommandArgs{"echo", "a b"},
+		},
+		{
+			name:    "current version",
+			content: `{"schema_version":2,"id":"%s","name":"cur","command":["echo","a b"],"status":"exited"}`,
+			command: container.CommandArgs{"echo", "a b"},
+		},
+		{
+			name:    "newer version",
+			content: `{"schema_version":99,"id":"%s","name":"new","command":["echo"],"status":"exited"}`,
+			wantErr: true,
+		},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.SetupRoot(t)
+			id := fmt.Sprintf("id%d", i)
+			writeRecord(t, id, fmt.Sprintf(tt.content, id))
+
+			info, err := Load(id)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("expected error for %s", tt.content)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("load error %v", err)
+			}
+			if !reflect.DeepEqual(info.Command, tt.command) {
+				t.Errorf("command = %q, want %q", info.Command, tt.command)
+			}
+			// 读取不修改文件，迁移后以当前格式写回
+			data, err := ioutil.ReadFile(Dir(id) + container.ConfigName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != fmt.Sprintf(tt.content, id) {
+				t.Errorf("record rewritten by load: %s", data)
+			}
+			if err := Migrate(); err != nil {
+				t.Fatalf("migrate error %v", err)
+			}
+			data, err = ioutil.ReadFile(Dir(id) + container.ConfigName)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var raw struct {
+				SchemaVersion int      `json:"schema_version"`
+				Command       []string `json:"command"`
+			}
+			if err := json.Unmarshal(data, &raw); err != nil {
+				t.Fatalf("stored record is not current format: %v", err)
+			}
+			if raw.SchemaVersion != SchemaVersion || !reflect.DeepEqual(container.CommandArgs(raw.Command), tt.command) {
+				t.Errorf("stored record = %s", data)
+			}
+		})
+	}
+}
+
+func TestMigrateWorkSpace(t *testing.T) {
+	tests := []struct {
+		name      string
+		legacy    bool // 存在以容器名命名的可写层
+		conflict  bool // 以 ID 命名的可写层已存在
+		running   bool // 容器进程仍然存在
+		wantErr   bool // 迁移失败，保留之前版本的记录与可写层
+		wantLayer bool // 迁移后以 ID 命名的可写层中存在 marker
+	}{
+		{name: "name keyed write layer", legacy: true, wantLayer: true},
+		{name: "no write layer"},
+		{name: "both write layers", legacy: true, conflict: true, wantErr: true},
+		{name: "running container", legacy: true, running: true, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			testutil.SetupRoot(t)
+			id, name := "abc", "web"
+			status, pid, startTime := "exited", "", ""
+			// 以测试进程作为存活的容器进程
+			if tt.running {
+				status, pid = container.RUNNING, strconv.Itoa(os.Getpid())
+				startTime, _ = container.ProcessStartTime(pid)
+			}
+			writeRecord(t, id, fmt.Sprintf(`{"schema_version":1,"id":"%s","name":"%s","status":"%s","pid":"%s","pid_start_time":"%s"}`,
+				id, name, status, pid, startTime))
+			oldURL := fmt.Sprintf(container.WriteLayerUrl, name)
+			newURL := fmt.Sprintf(container.WriteLayerUrl, id)
+			oldMntURL := fmt.Sprintf(container.MntURL, name)
+			if tt.legacy {
+				for _, dir := range []string{oldURL, oldMntURL} {
+					if err := os.MkdirAll(dir, 0755); err != nil {
+						t.Fatal(err)
+					}
+				}
+				if err := ioutil.WriteFile(filepath.Join(oldURL, "marker"), nil, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if tt.conflict {
+				if err := os.MkdirAll(newURL, 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := Migrate(); err != nil {
+				t.Fatalf("migrate error %v", err)
+			}
+			_, version, err := read(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.wantErr {
+				if version != 1 {
+					t.Errorf("schema version = %d, want 1", version)
+				}
+				if _, err := os.Stat(oldURL); err != nil {
+					t.Errorf("legacy write layer removed: %v", err)
+				}
+				// 迁移之前的修改保持原有的版本号
+				if err := Update(id, func(info *container.ContainerInfo) error {
+					info.RestartCount = 1
+					return nil
+				}); err != nil {
+					t.Fatal(err)
+				}
+				if _, version, _ := read(id); version != 1 {
+					t.Errorf("schema version after update = %d, want 1", version)
+				}
+				return
+			}
+			if version != SchemaVersion {
+				t.Errorf("schema version = %d, want %d", version, SchemaVersion)
+			}
+			if _, err := os.Stat(oldURL); !os.IsNotExist(err) {
+				t.Errorf("legacy write layer still exists: %v", err)
+			}
+			if _, err := os.Stat(oldMntURL); !os.IsNotExist(err) {
+				t.Errorf("legacy mount point still exists: %v", err)
+			}
+			_, err = os.Stat(filepath.Join(newURL, "marker"))
+			if tt.wantLayer != (err == nil) {
+				t.Errorf("stat migrated marker error %v, want exist %v", err, tt.wantLayer)
+			}
+		})
+	}
+}
+
+func TestMigrateDir(t *testing.T) {
+	testutil.SetupRoot(t)
+	id, name := "abc", "web"
+	writeRecord(t, name, fmt.Sprintf(`{"id":"%s","name":"%s","status":"exited"}`, id, name))
+
+	// 迁移之前不修改目录
+	if _, err := Load(name); err == nil {
+		t.Errorf("load container under its name want error")
+	}
+	if containers, err := List(); err != nil || len(containers) != 0 {
+		t.Errorf("List() = %v, %v, want no containers", containers, err)
+	}
+	if !Exists(name) {
+		t.Fatalf("name keyed directory moved before migrate")
+	}
+
+	if err := Migrate(); err != nil {
+		t.Fatalf("migrate error %v", err)
+	}
+	if Exists(name) || !Exists(id) {
+		t.Errorf("container directory not moved to %s", Dir(id))
+	}
+	info, err := Load(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Name != name {
+		t.Errorf("name = %s, want %s", info.Name, name)
+	}
+	if owner, err := os.Readlink(filepath.Join(namesDir(), name)); err != nil || owner != id {
+		t.Errorf("name %s reserved by %q, %v, want %s", name, owner, err, id)
+	}
+}
+
+func TestUpdateAndRemove(t *testing.T) {
+	testutil.SetupRoot(t)
+	id := "abc"
+	if err := Create(id); err != nil {
+		t.Fatal(err)
+	}
+	if err := Create(id); !os.IsExist(err) {
+		t.Fatalf("create existing container error = %v, want exist", err)
+	}
+	info := &container.ContainerInfo{ID: id, Name: "web", Status: container.Exit}
+	if err := Save(info); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReserveName(info.Name, id); err != nil {
+		t.Fatal(err)
+	}
+	if err := ReserveName(info.Name, "other"); err == nil {
+		t.Fatalf("name reserved twice")
+	}
+	if err := Update(id, func(info *container.ContainerInfo) error {
+		info.RestartCount = 3
+		return nil
+	}); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := Load(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if loaded.RestartCount != 3 || loaded.Name != "web" {
+		t.Errorf("loaded = %+v", loaded)
+	}
+	// 没有残留的临时文件
+	files, _ := ioutil.ReadDir(Dir(id))
+	for _, f := range files {
+		if f.Name() != container.ConfigName && f.Name() != lockFile {
+			t.Errorf("unexpected file %s", f.Name())
+		}
+	}
+
+	if err := Remove(loaded); err != nil {
+		t.Fatal(err)
+	}
+	if Exists(id) {
+		t.Errorf("container still exists after remove")
+	}
+	// 删除后不会被重新写入
+	if err := Save(loaded); !os.IsNotExist(err) {
+		t.Errorf("save removed container error = %v, want not exist", err)
+	}
+	if err := ReserveName(info.Name, "other"); err != nil {
+		t.Errorf("name not released: %v", err)
+	}
+}
@@ -2,13 +2,12 @@ package main
 
 import (
 	"copyDocker/container"
-	"encoding/json"
+	"copyDocker/state"
 	"fmt"
 	"github.com/sirupsen/logrus"
-	"io/ioutil"
-	"os"
 	"strconv"
 	"syscall"
+	"time"
 )
 
 /*
@@ -17,75 +16,138 @@ import (
  @Description: docker stop 的实现
 */
 
-// 1. 找到容器的PID
-// 2. kill 容器，信号量为SIGTERM，保证正常退出
-// 3. 更改 config 的状态，并重写
-func stopContainer(containerName string) {
-	pid, err := getContainerPidByName(containerName)
+// 1. 标记容器被手动停止，不会再按照重启策略重启
+// 2. kill 容器，信号默认为 SIGTERM，保证正常退出，超时后发送 SIGKILL
+// 3. 等待容器真正退出，状态由 monitor 记录
+func stopContainer(containerName string, timeout time.Duration) error {
+	info, err := lookupContainer(containerName)
 	if err != nil {
-		logrus.Errorf("Get container pid by name error:%v", err)
-		return
+		return err
+	}
+	// 先标记，monitor 看到后不会再按照重启策略重启容器
+	if err := markManuallyStopped(info); err != nil {
+		return err
+	}
+	// 等待重启的容器没有进程，通知 monitor 放弃重启
+	if !info.IsAlive() {
+		wakeMonitor(info)
+		return nil
+	}
+	if err := stopAndWait(info, timeout); err != nil {
+		return err
 	}
+	// 没有 monitor 的容器在读取时修正状态
+	state.Load(info.ID)
+	return nil
+}
 
-	pidInt, err := strconv.Atoi(pid)
+// 向容器发送信号，不等待容器退出
+func killContainer(containerName string, sig syscall.Signal) error {
+	info, err := lookupContainer(containerName)
 	if err != nil {
-		logrus.Errorf("Conver pid from string to int error: %v", err)
-		return
+		return err
 	}
-	// kill, SIGTERM 使程序正常退出
-	if err := syscall.Kill(pidInt, syscall.SIGTERM); err != nil {
-		logrus.Errorf("Stop container %s error %v.", containerName, err)
-		return
+	if !info.IsAlive() {
+		return fmt.Errorf("container %s is not running", containerName)
 	}
-	info, err := getContainerInfoByName(containerName)
+	pid, err := strconv.Atoi(info.Pid)
 	if err != nil {
-		return
+		return fmt.Errorf("invalid pid %s of container %s", info.Pid, containerName)
 	}
-	info.Status = container.STOP
-	info.Pid = ""
-	newBytes, err := json.Marshal(info)
-	if err != nil {
-		logrus.Errorf("Json marshal ContainerInfo error: ", err)
-		return
+	// SIGKILL 之类导致容器退出的信号也视为手动停止，不会被重启
+	// 暂停的容器只有 SIGKILL 需要恢复才能生效，其它信号等到 unpause 之后再处理
+	if sig == syscall.SIGKILL {
+		if err := markManuallyStopped(info); err != nil {
+			return err
+		}
 	}
-	dirURL := fmt.Sprintf(container.DefaultInfoLocation, containerName)
-	configPath := dirURL + container.ConfigName
-	if err := ioutil.WriteFile(configPath, newBytes, 0622); err != nil {
-		logrus.Errorf("Write file %s error %v.", configPath, err)
+	if err := syscall.Kill(pid, sig); err != nil {
+		return err
 	}
-
+	if sig == syscall.SIGKILL {
+		thawIfPaused(info)
+	}
+	return nil
 }
 
-func getContainerInfoByName(containerName string) (*container.ContainerInfo, error) {
-	dirURL := fmt.Sprintf(container.DefaultInfoLocation, containerName)
-	configFilePath := dirURL + container.ConfigName
-	contentBytes, err := ioutil.ReadFile(configFilePath)
+// 向容器发送 stop 信号，默认为 SIGTERM，超时后仍未退出则发送 SIGKILL，直到容器的 monitor 也退出
+func stopAndWait(info *container.ContainerInfo, timeout time.Duration) error {
+	pid, err := strconv.Atoi(info.Pid)
 	if err != nil {
-		logrus.Errorf("Read %s error: %v", configFilePath, err)
-		return nil, err
+		return fmt.Errorf("invalid pid %s of container %s", info.Pid, info.Name)
+	}
+	stopSignal := syscall.SIGTERM
+	if info.StopSignal != "" {
+		if stopSignal, err = container.ParseSignal(info.StopSignal); err != nil {
+			return err
+		}
+	}
+	if err := syscall.Kill(pid, stopSignal); err != nil && err != syscall.ESRCH {
+		return fmt.Errorf("stop container %s error %v", info.Name, err)
+	}
+	thawIfPaused(info)
+	if waitContainerStopped(info, timeout) {
+		return nil
 	}
-	var conInfo container.ContainerInfo
-	if err := json.Unmarshal(contentBytes, &conInfo); err != nil {
-		logrus.Errorf("GetContainerInfoByName unmarshal  error: %v", err)
-		return nil, err
+	logrus.Warnf("Container %s did not exit within %v, killing it", info.Name, timeout)
+	if err := syscall.Kill(pid, syscall.SIGKILL); err != nil && err != syscall.ESRCH {
+		return fmt.Errorf("kill container %s error %v", info.Name, err)
 	}
-	return &conInfo, nil
+	if !waitContainerStopped(info, monitorExitTimeout) {
+		return fmt.Errorf("container %s did not exit after SIGKILL", info.Name)
+	}
+	return nil
 }
 
-// 移除容器，在 stop 之后
-func removeContainer(containerName string) {
-	info, err := getContainerInfoByName(containerName)
-	if err != nil {
-		return
+// 等待容器进程与其 monitor 都退出，超时返回 false
+func waitContainerStopped(info *container.ContainerInfo, timeout time.Duration) bool {
+	deadline := time.Now().Add(timeout)
+	for info.IsAlive() || info.MonitorAlive() {
+		if time.Now().After(deadline) {
+			return false
+		}
+		time.Sleep(100 * time.Millisecond)
 	}
-	if info.Status != container.STOP {
-		logrus.Errorf("Couldn't remove running container")
+	return true
+}
+
+// 容器没有进程时 monitor 可能正在等待重启，向其发送 SIGTERM，使其放弃等待并退出
+// 交互运行的容器记录的是前台的 run 进程，它不是 monitor，没有处理 SIGTERM，不能发送
+func wakeMonitor(info *container.ContainerInfo) {
+	if info.Tty || !info.MonitorAlive() {
 		return
 	}
-	dirURL := fmt.Sprintf(container.DefaultInfoLocation, containerName)
-	if err := os.RemoveAll(dirURL); err != nil {
-		logrus.Errorf("Remove file %s error %v.", dirURL, err)
-		return
+	if pid, err := strconv.Atoi(info.MonitorPid); err == nil {
+		syscall.Kill(pid, syscall.SIGTERM)
+	}
+}
+
+// 标记容器被手动停止，等待重启的容器直接改为 exited，同时更新 info
+func markManuallyStopped(info *container.ContainerInfo) error {
+	mark := func(info *container.ContainerInfo) error {
+		info.ManuallyStopped = true
+		if info.Status == container.RESTARTING {
+			info.Status = container.Exit
+		}
+		return nil
+	}
+	mark(info)
+	return state.Update(info.ID, mark)
+}
+
+// 等待容器当前的进程退出，返回 monitor 记录的退出码，已经退出的容器直接返回
+func waitContainer(containerName string) (int, error) {
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return -1, err
+	}
+	for {
+		if info, err = state.Load(info.ID); err != nil {
+			return -1, err
+		}
+		if info.Status != container.RUNNING && info.Status != container.PAUSED {
+			return info.ExitCode, nil
+		}
+		time.Sleep(100 * time.Millisecond)
 	}
-	container.DeleteWorkSpace(info.Volume,info.Name)
 }
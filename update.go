@@ -0,0 +1,59 @@
+package main
+
+import (
+	"copyDocker/cgroups"
+	"copyDocker/cgroups/subsystems"
+	"copyDocker/container"
+	"copyDocker/state"
+	"strconv"
+)
+
+/*
+ @Author: as
+ @Date: Creat in 15:20 2022/3/30
+ @Description: docker update 的实现，修改容器的资源限制
+*/
+
+// 修改容器的资源限制，update 中为空的字段保持不变
+// 运行中的容器立即写入 cgroup，之后 start 时也使用新的限制
+func updateContainer(containerName string, update *subsystems.ResourceConfig) error {
+	info, err := lookupContainer(containerName)
+	if err != nil {
+		return err
+	}
+	resource := &subsystems.ResourceConfig{}
+	if info.Resource != nil {
+		*resource = *info.Resource
+	}
+	if update.MemoryLimit != "" {
+		resource.MemoryLimit = update.MemoryLimit
+	}
+	if update.CpuShare != "" {
+		resource.CpuShare = update.CpuShare
+	}
+	if update.CpuSet != "" {
+		resource.CpuSet = update.CpuSet
+	}
+	if update.PidsLimit != "" {
+		resource.PidsLimit = update.PidsLimit
+	}
+
+	// 暂停的容器同样可以修改
+	if info.IsAlive() {
+		if err := cgroups.NewCgroupManager(cgroups.ContainerPath(info.ID)).Set(resource); err != nil {
+			return err
+		}
+	}
+	return state.Update(info.ID, func(info *container.ContainerInfo) error {
+		info.Resource = resource
+		return nil
+	})
+}
+
+// 与 docker 相同，0 或负数表示不限制进程数
+func pidsLimit(limit int) string {
+	if limit <= 0 {
+		return "max"
+	}
+	return strconv.Itoa(limit)
+}
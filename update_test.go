@@ -0,0 +1,20 @@
+package main
+
+import "testing"
+
+func TestPidsLimit(t *testing.T) {
+	tests := []struct {
+		limit int
+		want  string
+	}{
+		{limit: -1, want: "max"},
+		{limit: 0, want: "max"},
+		{limit: 1, want: "1"},
+		{limit: 100, want: "100"},
+	}
+	for _, tt := range tests {
+		if got := pidsLimit(tt.limit); got != tt.want {
+			t.Errorf("pidsLimit(%d) = %s, want %s", tt.limit, got, tt.want)
+		}
+	}
+}